@@ -0,0 +1,202 @@
+//
+// Batch generation
+// Code to generate the directories for several wards at once,
+// such as every ward in a stake, from a manifest file
+//
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// one ward in a manifest
+// Settings is a file from “Export settings” and Membership lists the
+// ward's membership files in order of preference
+// Overrides and Baseline are optional; the overrides saved by the web
+// interface are for a single ward, so they are not used here
+type BatchWard struct {
+	Name       string
+	Settings   string
+	Membership []string
+	Overrides  string `json:",omitempty"`
+	Baseline   string `json:",omitempty"`
+}
+
+// the list of wards to generate
+type BatchManifest struct {
+	Wards []*BatchWard
+}
+
+// how one ward turned out
+type BatchResult struct {
+	Ward      *BatchWard
+	Filename  string
+	Directory *Directory
+	PDF       []byte
+	Rounds    int
+	Marked    int
+	Err       error
+}
+
+// read a manifest file
+// file names in it are relative to the manifest itself
+func ReadManifest(path string) (*BatchManifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	manifest := new(BatchManifest)
+	if err = json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("Parsing %s: %v", path, err)
+	}
+	if len(manifest.Wards) == 0 {
+		return nil, fmt.Errorf("No wards are listed in %s", path)
+	}
+
+	base := filepath.Dir(path)
+	resolve := func(name string) string {
+		if name == "" || filepath.IsAbs(name) {
+			return name
+		}
+		return filepath.Join(base, name)
+	}
+	for i, ward := range manifest.Wards {
+		if ward == nil || ward.Settings == "" || len(ward.Membership) == 0 {
+			return nil, fmt.Errorf("Ward %d in %s needs settings and at least one membership file", i+1, path)
+		}
+		if ward.Name == "" {
+			ward.Name = fmt.Sprintf("Ward %d", i+1)
+		}
+		ward.Settings = resolve(ward.Settings)
+		for j := range ward.Membership {
+			ward.Membership[j] = resolve(ward.Membership[j])
+		}
+		ward.Overrides = resolve(ward.Overrides)
+		ward.Baseline = resolve(ward.Baseline)
+	}
+	return manifest, nil
+}
+
+// generate the directory for every ward in the manifest
+// up to parallel wards are generated at once; the results are in the
+// same order as the manifest
+// editions are neither compared nor saved, since they are kept for a
+// single ward
+func (manifest *BatchManifest) Generate(gen *Generator, parallel int) []*BatchResult {
+	if parallel < 1 {
+		parallel = 1
+	}
+	results := make([]*BatchResult, len(manifest.Wards))
+	used := make(map[string]bool)
+	for i, ward := range manifest.Wards {
+		results[i] = &BatchResult{Ward: ward, Filename: ward.filename(used)}
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan bool, parallel)
+	for _, result := range results {
+		wg.Add(1)
+		go func(result *BatchResult) {
+			defer wg.Done()
+			slots <- true
+			defer func() { <-slots }()
+			result.Err = result.generate(gen)
+		}(result)
+	}
+	wg.Wait()
+	return results
+}
+
+// run the pipeline for one ward
+func (result *BatchResult) generate(gen *Generator) error {
+	ward := result.Ward
+
+	// each ward gets its own settings and fonts
+	dir, err := gen.ReadSettings(ward.Settings)
+	if err != nil {
+		return err
+	}
+	result.Directory = dir
+
+	// load the membership data
+	var files []*MembershipFile
+	for _, name := range ward.Membership {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("reading membership data: %v", err)
+		}
+		files = append(files, &MembershipFile{Name: name, Data: data})
+	}
+	if err := dir.ReadMembership(files); err != nil {
+		return err
+	}
+
+	if ward.Overrides != "" {
+		overrides, err := ReadOverrides(ward.Overrides)
+		if err != nil {
+			return fmt.Errorf("loading overrides: %v", err)
+		}
+		dir.ApplyOverrides(overrides)
+	}
+
+	// flag households that are not in the baseline
+	if ward.Baseline != "" && dir.MarkNewHouseholds {
+		data, err := ioutil.ReadFile(ward.Baseline)
+		if err != nil {
+			return fmt.Errorf("reading the baseline: %v", err)
+		}
+		baseline, err := dir.ReadBaseline(&MembershipFile{Name: ward.Baseline, Data: data})
+		if err != nil {
+			return err
+		}
+		result.Marked = dir.MarkNew(baseline)
+	}
+
+	result.PDF, result.Rounds, err = dir.MakeDirectory()
+	return err
+}
+
+// the file name for a ward's directory, named after the ward
+// names already used are numbered to keep them apart
+func (ward *BatchWard) filename(used map[string]bool) string {
+	base := strings.TrimSpace(unsafeFilename.ReplaceAllString(ward.Name, "_"))
+	if base == "" {
+		base = "directory"
+	}
+	name := base + ".pdf"
+	for n := 2; used[strings.ToLower(name)]; n++ {
+		name = fmt.Sprintf("%s (%d).pdf", base, n)
+	}
+	used[strings.ToLower(name)] = true
+	return name
+}
+
+// a zip file with the directory for each ward that succeeded
+func ZipDirectories(results []*BatchResult) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		fp, err := archive.Create(result.Filename)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = fp.Write(result.PDF); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -1,4 +1,10 @@
-package main
+//
+// Address cleanup
+// Code to check addresses against the SmartyStreets service,
+// keeping the results in a cache file between runs
+//
+
+package cleanup
 
 import (
 	"bytes"
@@ -9,10 +15,12 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+
+	"github.com/russross/warddirectory/membership"
 )
 
 type AddressRecord struct {
@@ -31,11 +39,19 @@ type SmartyStreet struct {
 	MaxPerRequest int
 }
 
-var smartystreetConfigPath = filepath.Join(os.Getenv("HOME"), ".warddirectory-smartystreets.json")
-var addressCachePath = filepath.Join(os.Getenv("HOME"), ".warddirectory-addresscache.json")
+// the cache file is read, updated, and written back by each cleanup,
+// so only one cleanup runs at a time
+var addressCacheLock sync.Mutex
+
+// correct the addresses of the families using the SmartyStreets
+// settings in configPath and the cache in cachePath, and drop middle names
+// nothing is looked up if there is no settings file, but addresses
+// already in the cache are still corrected
+func Addresses(families []*membership.Family, configPath, cachePath string) error {
+	addressCacheLock.Lock()
+	defer addressCacheLock.Unlock()
 
-func (dir *Directory) CleanupAddresses() error {
-	config, err := readAddressConfig(smartystreetConfigPath)
+	config, err := readAddressConfig(configPath)
 
 	// quit on error or config not found
 	if err != nil {
@@ -43,7 +59,7 @@ func (dir *Directory) CleanupAddresses() error {
 	}
 
 	// read the cache
-	cache, err := readAddressCache(addressCachePath, config != nil)
+	cache, err := readAddressCache(cachePath, config != nil)
 	if err != nil {
 		log.Printf("Error loading address cache: %v", err)
 		return err
@@ -55,7 +71,7 @@ func (dir *Directory) CleanupAddresses() error {
 
 		// gather all the addresses that need to be looked up
 		missing := []string{}
-		for _, f := range dir.Families {
+		for _, f := range families {
 			address := strings.Join(f.Address, "\n")
 			if _, present := cache[address]; !present {
 				missing = append(missing, address)
@@ -74,10 +90,10 @@ func (dir *Directory) CleanupAddresses() error {
 	}
 
 	// report corrections that should be made to records
-	reportCorrections(dir.Families, cache)
+	reportCorrections(families, cache)
 
 	// remove middle names
-	for _, f := range dir.Families {
+	for _, f := range families {
 		for _, p := range f.People {
 			var out []string
 			lastfirst := strings.Split(p.Name, ", ")
@@ -91,7 +107,7 @@ func (dir *Directory) CleanupAddresses() error {
 	}
 
 	// now substitute in the corrected addresses
-	for _, f := range dir.Families {
+	for _, f := range families {
 		address := strings.Join(f.Address, "\n")
 		elt, present := cache[address]
 		if !present {
@@ -104,8 +120,8 @@ func (dir *Directory) CleanupAddresses() error {
 
 	if config != nil {
 		// save the updated version of the cache
-		log.Printf("Saving updated address cache to %s", addressCachePath)
-		if err = writeAddressCache(addressCachePath, cache); err != nil {
+		log.Printf("Saving updated address cache to %s", cachePath)
+		if err = writeAddressCache(cachePath, cache); err != nil {
 			log.Printf("Error saving address cache: %s", err)
 			return err
 		}
@@ -365,7 +381,7 @@ func formAddressRequest(addr string) *AddressRequest {
 	return nil
 }
 
-func reportCorrections(families []*Family, cache map[string]*AddressRecord) {
+func reportCorrections(families []*membership.Family, cache map[string]*AddressRecord) {
 	var cityFrom = regexp.MustCompile(`, UT\b`)
 	var cityTo = `, Utah`
 	var phoneTemplate = regexp.MustCompile(`^\d{3}-\d{3}-\d{4}$`)
@@ -374,8 +390,8 @@ func reportCorrections(families []*Family, cache map[string]*AddressRecord) {
 
 		// check for phone number corrections
 		if f.Phone != "" {
-			phone := Phone10Digit.ReplaceAllString(f.Phone, "$1-$2-$3")
-			phone = Phone7Digit.ReplaceAllString(phone, "435-$1-$2")
+			phone := membership.Phone10Digit.ReplaceAllString(f.Phone, "$1-$2-$3")
+			phone = membership.Phone7Digit.ReplaceAllString(phone, "435-$1-$2")
 			if !phoneTemplate.MatchString(f.Phone) {
 				if phoneTemplate.MatchString(phone) {
 					fmt.Fprintf(report, "\tphone correction: %s to %s\n", f.Phone, phone)
@@ -393,8 +409,8 @@ func reportCorrections(families []*Family, cache map[string]*AddressRecord) {
 				fmt.Fprintf(report, "\tmiddle name is included in preferred name: %s\n", person.Name)
 			}
 			if person.Phone != "" {
-				phone := Phone10Digit.ReplaceAllString(person.Phone, "$1-$2-$3")
-				phone = Phone7Digit.ReplaceAllString(phone, "435-$1-$2")
+				phone := membership.Phone10Digit.ReplaceAllString(person.Phone, "$1-$2-$3")
+				phone = membership.Phone7Digit.ReplaceAllString(phone, "435-$1-$2")
 				if !phoneTemplate.MatchString(person.Phone) {
 					if phoneTemplate.MatchString(phone) {
 						fmt.Fprintf(report, "\tphone correction for %s: %s to %s\n", person.Name, person.Phone, phone)
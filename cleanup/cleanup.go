@@ -0,0 +1,105 @@
+//
+// Entry cleanup
+// Code to tidy the names, addresses, phone numbers, and email
+// addresses of households using the clerk's regular expressions
+//
+
+// Package cleanup tidies the details of households before they are
+// printed: regular expression substitutions on names, addresses, and
+// phone numbers, and address correction through SmartyStreets.
+package cleanup
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/russross/warddirectory/membership"
+)
+
+// a substitution made on each name, address line, or phone number
+type RegularExpression struct {
+	Expression  string
+	Replacement string
+
+	Regexp *regexp.Regexp `json:"-" schema:"-"`
+}
+
+var FallbackRegexp = regexp.MustCompile(`^I don't match anything$`)
+
+// compile a list of expressions, dropping blank ones
+// an expression that does not compile is marked and never matches
+func Compile(lst []*RegularExpression) (out []*RegularExpression) {
+	var err error
+	for _, elt := range lst {
+		if strings.TrimSpace(elt.Expression) != "" {
+			out = append(out, elt)
+		}
+		if elt.Regexp, err = regexp.Compile("(?mi:" + elt.Expression + ")"); err != nil {
+			elt.Regexp = FallbackRegexp
+			elt.Expression = "!!Error!! " + elt.Expression
+		}
+	}
+	return out
+}
+
+// apply the name substitutions
+func PrepName(regexps []*RegularExpression, name string) string {
+	// prepare name
+	for _, re := range regexps {
+		name = re.Regexp.ReplaceAllString(strings.TrimSpace(name), re.Replacement)
+		name = membership.Spaces.ReplaceAllString(name, " ")
+		name = strings.TrimSpace(name)
+	}
+
+	return name
+}
+
+// apply the address substitutions to each line,
+// dropping lines that end up empty
+func PrepAddress(regexps []*RegularExpression, address []string) []string {
+	// prepare address
+	var out []string
+	for _, line := range address {
+		for _, re := range regexps {
+			line = re.Regexp.ReplaceAllString(strings.TrimSpace(line), re.Replacement)
+			line = membership.Spaces.ReplaceAllString(line, " ")
+			line = strings.TrimSpace(line)
+		}
+		if len(line) > 0 {
+			out = append(out, line)
+		}
+	}
+
+	return out
+}
+
+// prepare phone number
+// a phone number that matches familyPhone is dropped
+func PrepPhone(regexps []*RegularExpression, phone, familyPhone string) string {
+	// first extract groups of digits and put it in the form 123-456-7890
+	phone = membership.Phone10Digit.ReplaceAllString(phone, "$1-$2-$3")
+
+	// same for 123-4567
+	phone = membership.Phone7Digit.ReplaceAllString(phone, "$1-$2")
+
+	for _, re := range regexps {
+		phone = re.Regexp.ReplaceAllString(phone, re.Replacement)
+		phone = membership.Spaces.ReplaceAllString(phone, " ")
+		phone = strings.TrimSpace(phone)
+	}
+
+	if phone == familyPhone {
+		phone = ""
+	}
+
+	return phone
+}
+
+// an email address that matches familyEmail is dropped
+func PrepEmail(email, familyEmail string) string {
+	if strings.ToLower(email) == strings.ToLower(familyEmail) {
+		email = ""
+	}
+
+	return email
+}
@@ -0,0 +1,267 @@
+//
+// Editions
+// Code to save a snapshot of the families each time a directory is
+// generated, and to list what changed since the last one: who moved
+// in, who moved out, who moved, and whose phone or email changed
+//
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/russross/warddirectory/membership"
+)
+
+// snapshots are household files named by the time they were saved
+var editionsPath = homeFile(".warddirectory-editions")
+
+const editionTimeFormat = "2006-01-02-150405.000"
+
+// snapshots saved before names had milliseconds
+const oldEditionTimeFormat = "2006-01-02-150405"
+
+// a saved snapshot of the families
+type Edition struct {
+	Saved    time.Time
+	Families []*membership.Family
+
+	// the file as it was saved
+	data []byte
+}
+
+// one detail that changed for a family
+type FamilyChange struct {
+	Family string
+	Field  string
+	Old    string
+	New    string
+}
+
+// what changed between two editions
+type EditionChanges struct {
+	Since   time.Time
+	Added   []string
+	Removed []string
+	Moved   []*FamilyChange
+	Changed []*FamilyChange
+}
+
+// how a family is listed in the change report
+func familyLabel(family *membership.Family) string {
+	if family.Couple == "" {
+		return family.Surname
+	}
+	return family.Surname + " (" + family.Couple + ")"
+}
+
+// encode the families as a snapshot, leaving out photos
+func (dir *Directory) EncodeEdition() ([]byte, error) {
+	var families []*membership.Family
+	for _, family := range dir.Families {
+		elt := *family
+		elt.Photo = nil
+		families = append(families, &elt)
+	}
+	return membership.EncodeHouseholds(families)
+}
+
+// write a snapshot made by EncodeEdition
+func SaveEdition(data []byte, when time.Time) error {
+	if err := os.MkdirAll(editionsPath, 0755); err != nil {
+		return err
+	}
+	name := filepath.Join(editionsPath, when.Format(editionTimeFormat)+".json")
+	log.Printf("Saving edition to %s", name)
+
+	// never replace an edition saved at the same moment
+	fp, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return fmt.Errorf("Edition %s already exists", name)
+	} else if err != nil {
+		return err
+	}
+	if _, err = fp.Write(data); err != nil {
+		fp.Close()
+		return err
+	}
+	return fp.Close()
+}
+
+// the time an edition was saved, from its file name
+func editionTime(name string) (time.Time, error) {
+	name = strings.TrimSuffix(name, ".json")
+	saved, err := time.ParseInLocation(editionTimeFormat, name, time.Local)
+	if err != nil {
+		saved, err = time.ParseInLocation(oldEditionTimeFormat, name, time.Local)
+	}
+	return saved, err
+}
+
+// load the most recent snapshot, or nil if there are none
+func LatestEdition() (*Edition, error) {
+	entries, err := ioutil.ReadDir(editionsPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// find the newest; names with and without milliseconds do not
+	// sort together, so compare the times
+	var name string
+	var saved time.Time
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		when, err := editionTime(entry.Name())
+		if err != nil {
+			continue
+		}
+		if name == "" || when.After(saved) {
+			name, saved = entry.Name(), when
+		}
+	}
+	if name == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(editionsPath, name))
+	if err != nil {
+		return nil, err
+	}
+	families, _, err := membership.ParseHouseholds(data)
+	if err != nil {
+		return nil, fmt.Errorf("Reading edition %s: %v", name, err)
+	}
+	return &Edition{Saved: saved, Families: families, data: data}, nil
+}
+
+// remember the last edition saved before this membership data was read
+// every directory made from the data is compared with it, so the
+// changes and new households are still reported after the data has
+// been saved as an edition of its own
+func (dir *Directory) LoadPreviousEdition() {
+	previous, err := LatestEdition()
+	if err != nil {
+		log.Printf("Loading the last edition: %v", err)
+		previous = nil
+	}
+	dir.Previous = previous
+}
+
+// save a snapshot made by EncodeEdition, unless it is the same as the
+// latest edition
+func SaveNewEdition(data []byte, when time.Time) error {
+	latest, err := LatestEdition()
+	if err != nil {
+		return err
+	}
+	if latest != nil && bytes.Equal(latest.data, data) {
+		return nil
+	}
+	return SaveEdition(data, when)
+}
+
+// compare the current families with an earlier edition
+// families are matched by surname and couple, or by surname and address
+func (dir *Directory) CompareEdition(previous *Edition) *EditionChanges {
+	changes := &EditionChanges{Since: previous.Saved}
+
+	known := make(map[string]*membership.Family)
+	for _, family := range previous.Families {
+		for _, key := range membership.FamilyKeys(family) {
+			if known[key] == nil {
+				known[key] = family
+			}
+		}
+	}
+
+	found := make(map[*membership.Family]bool)
+	for _, family := range dir.Families {
+		var old *membership.Family
+		for _, key := range membership.FamilyKeys(family) {
+			if elt := known[key]; elt != nil && !found[elt] {
+				old = elt
+				break
+			}
+		}
+		if old == nil {
+			changes.Added = append(changes.Added, familyLabel(family))
+			continue
+		}
+		found[old] = true
+		label := familyLabel(family)
+
+		if membership.AddressKey(old.Address) != membership.AddressKey(family.Address) {
+			changes.Moved = append(changes.Moved, &FamilyChange{
+				Family: label,
+				Field:  "address",
+				Old:    strings.Join(old.Address, ", "),
+				New:    strings.Join(family.Address, ", "),
+			})
+		}
+		change := func(field, oldValue, newValue string) {
+			if strings.Join(membership.NormalizeWords(oldValue), " ") != strings.Join(membership.NormalizeWords(newValue), " ") {
+				changes.Changed = append(changes.Changed, &FamilyChange{
+					Family: label,
+					Field:  field,
+					Old:    oldValue,
+					New:    newValue,
+				})
+			}
+		}
+		change("phone", old.Phone, family.Phone)
+		change("email", old.Email, family.Email)
+
+		people := make(map[string]*membership.Person)
+		for _, person := range old.People {
+			people[membership.NameKey(person.Name)] = person
+		}
+		for _, person := range family.People {
+			if elt := people[membership.NameKey(person.Name)]; elt != nil {
+				change("phone for "+person.Name, elt.Phone, person.Phone)
+				change("email for "+person.Name, elt.Email, person.Email)
+			}
+		}
+	}
+
+	for _, family := range previous.Families {
+		if !found[family] {
+			changes.Removed = append(changes.Removed, familyLabel(family))
+		}
+	}
+	return changes
+}
+
+// flag the families that are not in the baseline list
+// families are matched the same way as when comparing editions
+func (dir *Directory) MarkNew(baseline []*membership.Family) (count int) {
+	known := make(map[string]bool)
+	for _, family := range baseline {
+		for _, key := range membership.FamilyKeys(family) {
+			known[key] = true
+		}
+	}
+	for _, family := range dir.Families {
+		family.New = true
+		for _, key := range membership.FamilyKeys(family) {
+			if known[key] {
+				family.New = false
+				break
+			}
+		}
+		if family.New {
+			count++
+		}
+	}
+	return count
+}
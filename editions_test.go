@@ -0,0 +1,145 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/russross/warddirectory/membership"
+)
+
+func TestGenerateEditions(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "editions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	old := editionsPath
+	editionsPath = tmp
+	defer func() { editionsPath = old }()
+
+	// the last edition is missing the Jones household
+	first := &Directory{Families: privacyFamilies()[:1]}
+	data, err := first.EncodeEdition()
+	if err != nil {
+		t.Fatal(err)
+	}
+	since := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err = SaveEdition(data, since); err != nil {
+		t.Fatal(err)
+	}
+
+	gen, err := NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the uploaded data is read once, then used for several directories
+	upload := privacyFamilies()
+	var previous *Edition
+	generate := func(label string, families []*membership.Family) {
+		dir := gen.Defaults()
+		gen.Prepare(dir)
+		dir.MarkNewHouseholds = true
+		dir.Families = membership.CopyFamilies(families)
+		dir.Report = new(membership.ParseReport)
+		if previous == nil {
+			dir.LoadPreviousEdition()
+			previous = dir.Previous
+		}
+		dir.Previous = previous
+
+		result, err := dir.Generate(nil, "")
+		if err != nil {
+			t.Fatalf("%s: %v", label, err)
+		}
+		if result.Changes == nil || !result.Changes.Since.Equal(since) || len(result.Changes.Added) != 101 {
+			t.Errorf("%s: expected the changes since the first edition, found %+v", label, result.Changes)
+		}
+		if result.Marked != 101 {
+			t.Errorf("%s: expected 101 new households, found %d", label, result.Marked)
+		}
+	}
+	editions := func() int {
+		entries, err := ioutil.ReadDir(tmp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(entries)
+	}
+
+	generate("first directory", upload)
+	if n := editions(); n != 2 {
+		t.Errorf("first directory: expected 2 editions, found %d", n)
+	}
+
+	// the same families again are not a new edition
+	generate("second directory", upload)
+	if n := editions(); n != 2 {
+		t.Errorf("second directory: expected 2 editions, found %d", n)
+	}
+
+	// but a change is
+	upload[1].Phone = "555-0000"
+	generate("third directory", upload)
+	latest, err := LatestEdition()
+	if err != nil || latest == nil {
+		t.Fatalf("loading the latest edition: %v", err)
+	}
+	if latest.Families[1].Phone != "555-0000" {
+		t.Errorf("third directory: the change was not saved as an edition")
+	}
+}
+
+func TestEditionNames(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "editions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	old := editionsPath
+	editionsPath = tmp
+	defer func() { editionsPath = old }()
+
+	// a snapshot named before names had milliseconds
+	second := time.Date(2026, 10, 18, 9, 30, 15, 0, time.Local)
+	families := privacyFamilies()
+	data, err := (&Directory{Families: families[:1]}).EncodeEdition()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(tmp, second.Format(oldEditionTimeFormat)+".json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// two more in the same second
+	for i := 1; i <= 2; i++ {
+		data, err := (&Directory{Families: families[:i+1]}).EncodeEdition()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = SaveEdition(data, second.Add(time.Duration(i)*time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = SaveEdition(data, second.Add(2*time.Millisecond)); err == nil {
+		t.Errorf("expected an error saving over an edition")
+	}
+	entries, err := ioutil.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("expected 3 editions, found %d", len(entries))
+	}
+
+	latest, err := LatestEdition()
+	if err != nil || latest == nil {
+		t.Fatalf("loading the latest edition: %v", err)
+	}
+	if !latest.Saved.Equal(second.Add(2*time.Millisecond)) || len(latest.Families) != 3 {
+		t.Errorf("latest edition was saved %v with %d families", latest.Saved, len(latest.Families))
+	}
+}
@@ -10,66 +10,69 @@
 package main
 
 import (
-	"regexp"
 	"strings"
-)
-
-type Person struct {
-	Name  string
-	Phone string
-	Email string
-}
 
-type Family struct {
-	Surname   string
-	Couple    string
-	HasCouple bool
-	Address   []string
-	Phone     string
-	Email     string
-	People    []*Person
-}
+	"github.com/russross/warddirectory/cleanup"
+	"github.com/russross/warddirectory/font"
+	"github.com/russross/warddirectory/layout"
+)
 
 // space: -1 means no leading space 0 regular, 1+ penalty for line break
-func packBox(lst []*Box, elt string, space int, font *FontMetrics) (entry []*Box) {
-	var box *Box
+func packBox(lst []*layout.Box, elt string, space int, f *font.Metrics) (entry []*layout.Box) {
+	var box *layout.Box
 	if len(lst) == 0 {
-		return []*Box{font.MakeBox(elt, 1.0)}
+		return []*layout.Box{layout.MakeBox(f, elt, 1.0)}
 	}
 
 	prev := lst[len(lst)-1]
 
 	switch {
 	// can we tack this on to the end of the previous box?
-	case space < 0 && prev.Font == font:
-		box = font.MakeBox(prev.Original+elt, 1.0)
+	case space < 0 && prev.Font == f:
+		box = layout.MakeBox(f, prev.Original+elt, 1.0)
 		lst[len(lst)-1] = box
 		return lst
 
 	// join this to the previous box, but with different fonts
 	case space < 0:
 		prev.JoinNext = true
-		box = font.MakeBox(elt, 1.0)
+		box = layout.MakeBox(f, elt, 1.0)
 		return append(lst, box)
 
 	// make a new box
 	default:
-		box = font.MakeBox(elt, 1.0)
+		box = layout.MakeBox(f, elt, 1.0)
 		prev.Penalty = space
 		return append(lst, box)
 	}
 }
 
 func (dir *Directory) FormatFamilies() {
+	// explain the new household marker if any households have it
+	if dir.MarkNewHouseholds && dir.NewHouseholdMarker != "" && dir.NewHouseholdLegend != "" {
+		for _, family := range dir.Families {
+			if family.New {
+				dir.Legend = dir.NewHouseholdLegend
+				break
+			}
+		}
+	}
+
 	for _, family := range dir.Families {
-		var entry []*Box
+		var entry []*layout.Box
+
+		// flag households that are new since the baseline
+		if dir.MarkNewHouseholds && family.New && dir.NewHouseholdMarker != "" {
+			entry = packBox(entry, dir.NewHouseholdMarker, 0, dir.Bold)
+		}
 
 		// start with the surname in bold
 		for i, word := range strings.Fields(family.Surname) {
 			space := 0
 
 			// strongly discourage line breaks within a surname
-			if i > 0 {
+			// or between the marker and the surname
+			if i > 0 || len(entry) > 0 {
 				space = 2
 			}
 			entry = packBox(entry, word, space, dir.Bold)
@@ -182,28 +185,8 @@ func (dir *Directory) FormatFamilies() {
 	}
 }
 
-var FallbackRegexp = regexp.MustCompile(`^I don't match anything$`)
-
 func (dir *Directory) CompileRegexps() {
-	var err error
-	kinds := []*[]*RegularExpression{
-		&dir.PhoneRegexps,
-		&dir.AddressRegexps,
-		&dir.NameRegexps,
-	}
-	for _, kind := range kinds {
-		old := *kind
-		*kind = nil
-		for _, elt := range old {
-			if strings.TrimSpace(elt.Expression) != "" {
-				*kind = append(*kind, elt)
-			}
-			if elt.Regexp, err = regexp.Compile("(?mi:" + elt.Expression + ")"); err != nil {
-				elt.Regexp = FallbackRegexp
-				elt.Expression = "!!Error!! " + elt.Expression
-			}
-		}
-	}
-
-	return
+	dir.PhoneRegexps = cleanup.Compile(dir.PhoneRegexps)
+	dir.AddressRegexps = cleanup.Compile(dir.AddressRegexps)
+	dir.NameRegexps = cleanup.Compile(dir.NameRegexps)
 }
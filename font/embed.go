@@ -0,0 +1,96 @@
+//
+// Embedding fonts
+// Code to add fonts to a PDF file with the encoding used by the text
+//
+
+package font
+
+import (
+	"github.com/russross/warddirectory/pdf"
+)
+
+// add the font to a PDF document
+// only the glyphs that have been given codes are included in the
+// encoding, so this should be called once the text has been laid out
+func (font *Metrics) Embed(doc *pdf.Document) (ref pdf.Ref, err error) {
+	var fontobject pdf.Map
+
+	// built in font
+	if len(font.File) == 0 {
+		fontobject = pdf.Map{
+			"Type":     pdf.Name("Font"),
+			"Subtype":  pdf.Name("Type1"),
+			"BaseFont": pdf.Name(font.Name),
+		}
+
+	} else {
+		// build the list of widths
+		widths := pdf.WidthSlice(nil)
+		for n := font.FirstChar; n <= font.LastChar; n++ {
+			if name, present := font.CodePointToName[n]; present {
+				widths = append(widths, font.Glyphs[name].Width)
+			} else {
+				widths = append(widths, 0)
+			}
+		}
+
+		// embed the font file
+		file := &pdf.Stream{
+			Map: pdf.Map{
+				"Length1": pdf.Number(len(font.File)),
+				"Length2": pdf.Number(0),
+				"Length3": pdf.Number(0),
+			},
+			Data:       font.File,
+			Compressed: font.CompressedFile,
+		}
+		file_ref := doc.TopLevelObject(file)
+
+		// make the font descriptor
+		descriptor := pdf.Map{
+			"Type":     pdf.Name("FontDescriptor"),
+			"FontName": pdf.Name(font.Name),
+			"Flags":    pdf.Number(font.Flags),
+			"FontBBox": pdf.Slice{
+				pdf.Number(font.BBoxLeft),
+				pdf.Number(font.BBoxBottom),
+				pdf.Number(font.BBoxRight),
+				pdf.Number(font.BBoxTop),
+			},
+			"ItalicAngle": pdf.Number(font.ItalicAngle),
+			"Ascent":      pdf.Number(font.Ascent),
+			"Descent":     pdf.Number(font.Descent),
+			"CapHeight":   pdf.Number(font.CapHeight),
+			"StemV":       pdf.Number(font.StemV),
+			"FontFile":    file_ref,
+		}
+		descriptor_ref := doc.TopLevelObject(descriptor)
+
+		fontobject = pdf.Map{
+			"Type":           pdf.Name("Font"),
+			"Subtype":        pdf.Name("Type1"),
+			"BaseFont":       pdf.Name(font.Name),
+			"FirstChar":      pdf.Number(font.FirstChar),
+			"LastChar":       pdf.Number(font.LastChar),
+			"Widths":         widths,
+			"FontDescriptor": descriptor_ref,
+		}
+	}
+
+	// does it need an encoding?
+	if font.LastChar > 0x7f {
+		differences := pdf.Slice{pdf.Number(0x80)}
+		for i := rune(0x80); i <= font.LastChar; i++ {
+			differences = append(differences, pdf.Name(font.CodePointToName[i]))
+		}
+		encoding := pdf.Map{
+			"Type":        pdf.Name("Encoding"),
+			"Differences": differences,
+		}
+		encoding_ref := doc.TopLevelObject(encoding)
+		fontobject["Encoding"] = encoding_ref
+	}
+
+	ref = doc.TopLevelObject(fontobject)
+	return
+}
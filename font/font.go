@@ -0,0 +1,298 @@
+//
+// Font metric files
+// Code to parse and represent font metrics
+//
+
+// Package font reads Type 1 font metrics (.afm files) and font files
+// (.pfb files), maps text to glyphs, and embeds the fonts in PDF files.
+package font
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// the glyph used for characters that a font does not have
+const FallbackGlyph = "question"
+
+// metrics for a single glyph from a font
+type GlyphMetrics struct {
+	Code       rune
+	Width      int
+	Name       string
+	BBoxLeft   int
+	BBoxBottom int
+	BBoxRight  int
+	BBoxTop    int
+	Ligatures  map[string]string
+	Kerning    map[string]int
+}
+
+// metrics for an entire font
+type Metrics struct {
+	Name           string
+	Label          string
+	Glyphs         map[string]*GlyphMetrics
+	File           []byte
+	CompressedFile []byte
+
+	CapHeight   int
+	FirstChar   rune
+	LastChar    rune
+	Flags       int
+	BBoxLeft    int
+	BBoxBottom  int
+	BBoxRight   int
+	BBoxTop     int
+	ItalicAngle int
+	Ascent      int
+	Descent     int
+	StemV       int
+
+	NameToCode      map[string]string
+	CodePointToName map[rune]string
+
+	// the glyph to use for each character, shared by all of the
+	// fonts that were mapped together
+	Unicode map[rune]string
+}
+
+// load a font from its .afm metrics file and, if it is to be
+// embedded, its .pfb font file
+// stemV is used if the metrics do not give the stem width
+func Load(metrics, fontFile string, label string, stemV int) (font *Metrics, err error) {
+	if font, err = ParseMetricsFile(metrics, label); err != nil {
+		return nil, fmt.Errorf("loading font metrics: %v", err)
+	}
+	if stemV > 0 && font.StemV <= 0 {
+		font.StemV = stemV
+	}
+	if len(fontFile) > 0 {
+		font.File = []byte(fontFile)
+		var buf bytes.Buffer
+		var writer *zlib.Writer
+		if writer, err = zlib.NewWriterLevel(&buf, zlib.BestCompression); err != nil {
+			return nil, fmt.Errorf("Setting up zlib compressor: %v", err)
+		}
+		if _, err = writer.Write(font.File); err != nil {
+			return nil, fmt.Errorf("Writing to zlib compressor: %v", err)
+		}
+		if err = writer.Close(); err != nil {
+			return nil, fmt.Errorf("Closing zlib compressor: %v", err)
+		}
+		font.CompressedFile = buf.Bytes()
+	}
+
+	return font, nil
+}
+
+// parse a single glyph metric line from a .afm file
+func (font *Metrics) ParseGlyph(in string) error {
+	// sample: C 102 ; WX 333 ; N f ; B 20 0 383 683 ; L i fi ; L l fl ;
+	glyph := &GlyphMetrics{Ligatures: make(map[string]string), Kerning: make(map[string]int)}
+
+	for _, elt := range strings.Split(in, ";") {
+		elt = strings.TrimSpace(elt)
+		var a, b, c, d int
+		var r rune
+		var u, v string
+		if n, err := fmt.Sscanf(elt, "C %d", &r); n == 1 && err == nil {
+			glyph.Code = r
+		} else if n, err := fmt.Sscanf(elt, "CH %x", &r); n == 1 && err == nil {
+			glyph.Code = r
+		} else if n, err := fmt.Sscanf(elt, "WX %d", &a); n == 1 && err == nil {
+			glyph.Width = a
+		} else if n, err := fmt.Sscanf(elt, "N %s", &u); n == 1 && err == nil {
+			glyph.Name = u
+		} else if n, err := fmt.Sscanf(elt, "B %d %d %d %d", &a, &b, &c, &d); n == 4 && err == nil {
+			glyph.BBoxLeft, glyph.BBoxBottom, glyph.BBoxRight, glyph.BBoxTop = a, b, c, d
+		} else if n, err := fmt.Sscanf(elt, "L %s %s", &u, &v); n == 2 && err == nil {
+			glyph.Ligatures[u] = v
+		} else if elt == "" {
+		} else {
+			return errors.New("Unknown glyph metric field: [" + elt + "] from [" + in + "]")
+		}
+	}
+
+	if glyph.Name == "" {
+		return errors.New("No glyph name found in metric line: [" + in + "]")
+	}
+
+	if other, present := font.Glyphs[glyph.Name]; present && 0x20 <= other.Code && other.Code < 0x80 {
+		// keep the one with an ascii code
+	} else {
+		font.Glyphs[glyph.Name] = glyph
+	}
+
+	return nil
+}
+
+// parse a single glyph kerning line from a .afm file
+func (font *Metrics) ParseKerning(in string) error {
+	// sample: KPX f i -20
+	var a int
+	var u, v string
+	if n, err := fmt.Sscanf(in, "KPX %s %s %d", &u, &v, &a); n == 3 && err == nil {
+		glyph, present := font.Glyphs[u]
+		if !present {
+			return errors.New("Kerning found for unknown glyph: [" + in + "]")
+		}
+		glyph.Kerning[v] = a
+	} else {
+		return errors.New("Unknown kerning line: [" + in + "]")
+	}
+
+	return nil
+}
+
+// parse and entire .afm file
+func ParseMetricsFile(file string, label string) (font *Metrics, err error) {
+	font = &Metrics{
+		Glyphs: make(map[string]*GlyphMetrics),
+		Label:  label,
+		Flags:  1<<1 | 1<<5,
+	}
+	lines := strings.Split(file, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		a, b, c, d, count := 0, 0, 0, 0, 0
+		n := 0
+		s := ""
+		if n, err = fmt.Sscanf(line, "CapHeight %d", &a); n == 1 && err == nil {
+			font.CapHeight = a
+		} else if n, err = fmt.Sscanf(line, "FontBBox %d %d %d %d", &a, &b, &c, &d); n == 4 && err == nil {
+			font.BBoxLeft = a
+			font.BBoxBottom = b
+			font.BBoxRight = c
+			font.BBoxTop = d
+		} else if n, err = fmt.Sscanf(line, "ItalicAngle %d", &a); n == 1 && err == nil {
+			font.ItalicAngle = a
+		} else if n, err = fmt.Sscanf(line, "Ascender %d", &a); n == 1 && err == nil {
+			font.Ascent = a
+		} else if n, err = fmt.Sscanf(line, "Descender %d", &a); n == 1 && err == nil {
+			font.Descent = a
+		} else if n, err = fmt.Sscanf(line, "StdVW %d", &a); n == 1 && err == nil {
+			font.StemV = a
+		} else if n, err = fmt.Sscanf(line, "IsFixedPitch %s", &s); n == 1 && err == nil {
+			if s == "true" {
+				font.Flags |= 1
+			}
+		} else if n, err = fmt.Sscanf(line, "StartCharMetrics %d", &count); n == 1 && err == nil {
+			i += 1
+			for j := 0; j < count && i < len(lines); j, i = j+1, i+1 {
+				line := strings.TrimSpace(lines[i])
+				if err = font.ParseGlyph(line); err != nil {
+					return
+				}
+			}
+		} else if n, err = fmt.Sscanf(line, "StartKernPairs %d", &count); n == 1 && err == nil {
+			i += 1
+			for j := 0; j < count && i < len(lines); i++ {
+				line := strings.TrimSpace(lines[i])
+				if line == "" {
+					continue
+				}
+				if err = font.ParseKerning(line); err != nil {
+					return
+				}
+				j++
+			}
+		} else if n, err = fmt.Sscanf(line, "FontName %s", &s); n == 1 && err == nil {
+			font.Name = s
+		}
+		err = nil
+	}
+
+	return
+}
+
+// a copy with its own encoding, so glyphs can be mapped to codes
+// without changing the original
+// the metrics themselves are shared, since they never change
+func (font *Metrics) Copy() *Metrics {
+	if font == nil {
+		return nil
+	}
+	elt := new(Metrics)
+	*elt = *font
+	elt.NameToCode = make(map[string]string)
+	elt.CodePointToName = make(map[rune]string)
+	elt.FirstChar = 0
+	elt.LastChar = 0
+	return elt
+}
+
+// find the glyph for a character, or the fallback glyph if the font
+// does not have one
+func (font *Metrics) GetGlyph(ch rune) *GlyphMetrics {
+	// look up the shared mapping
+	name, present := font.Unicode[ch]
+	if !present {
+		return font.Glyphs[FallbackGlyph]
+	}
+
+	// see if the glyph is available in this font
+	glyph, present := font.Glyphs[name]
+	if !present {
+		return font.Glyphs[FallbackGlyph]
+	}
+
+	return glyph
+}
+
+// the code to use for a glyph in PDF strings
+// glyphs are given codes as they are first used, which are recorded in
+// the font so it can be embedded with the right encoding
+func (font *Metrics) GetCode(glyph *GlyphMetrics) string {
+	name := glyph.Name
+
+	// figure out how to represent this in strings,
+	// mapping it to a new codepoint if necessary
+	if code, present := font.NameToCode[name]; present {
+		return code
+	}
+
+	// record that this glyph has been used
+	if 0x20 <= glyph.Code && glyph.Code < 0x80 {
+		// it's an ascii character that can be mapped directly
+		if font.FirstChar == 0 || glyph.Code < font.FirstChar {
+			font.FirstChar = glyph.Code
+		}
+		if font.LastChar == 0 || glyph.Code > font.LastChar {
+			font.LastChar = glyph.Code
+		}
+
+		switch glyph.Code {
+		case '(':
+			font.NameToCode[name] = "\\("
+		case ')':
+			font.NameToCode[name] = "\\)"
+		case '\\':
+			font.NameToCode[name] = "\\\\"
+		default:
+			font.NameToCode[name] = string(glyph.Code)
+		}
+
+		font.CodePointToName[glyph.Code] = name
+	} else {
+		// reserve the next unused code point for this glyph
+		if font.LastChar < 0x7f {
+			font.LastChar = 0x7f
+		}
+		font.LastChar++
+
+		// make sure we haven't used up all 512 code points that
+		// we can access easily
+		if font.LastChar >= 0x200 {
+			panic("Too many different characters in use: international character support is limited")
+		}
+
+		font.NameToCode[name] = fmt.Sprintf("\\%03o", font.LastChar)
+		font.CodePointToName[font.LastChar] = name
+	}
+
+	return font.NameToCode[name]
+}
@@ -1,4 +1,9 @@
-package main
+//
+// Glyph lists
+// Code to map Unicode characters to the glyph names used by fonts
+//
+
+package font
 
 import (
 	"fmt"
@@ -6,8 +11,6 @@ import (
 	"strings"
 )
 
-var windows1252mappings map[rune]string
-
 func parseGlyphList(known map[string]bool, universal map[string]bool, file string) (mapping map[rune]string, err error) {
 	mapping = make(map[rune]string)
 
@@ -48,11 +51,27 @@ func parseGlyphList(known map[string]bool, universal map[string]bool, file strin
 	return
 }
 
-func GlyphMapping(lst map[string]*FontMetrics, glyphlist string) (mapping map[rune]string, err error) {
+// map characters to glyphs for a set of fonts, using a glyph list
+// file in the Adobe format; glyphs found in every font are preferred
+// each font is given the mapping, which is shared and never changed
+func MapGlyphs(fonts []*Metrics, glyphlist string) error {
+	mapping, err := glyphMapping(fonts, glyphlist)
+	if err != nil {
+		return err
+	}
+	for _, font := range fonts {
+		font.Unicode = mapping
+	}
+	return nil
+}
+
+func glyphMapping(lst []*Metrics, glyphlist string) (mapping map[rune]string, err error) {
 	union := make(map[string]bool)
 	intersection := make(map[string]bool)
-	for name, _ := range lst["times-roman"].Glyphs {
-		intersection[name] = true
+	if len(lst) > 0 {
+		for name, _ := range lst[0].Glyphs {
+			intersection[name] = true
+		}
 	}
 
 	for _, font := range lst {
@@ -0,0 +1,227 @@
+//
+// Generating a directory
+// The steps from membership files to a finished PDF file,
+// shared by the web page and the command line
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/russross/warddirectory/cleanup"
+	"github.com/russross/warddirectory/membership"
+)
+
+var smartystreetConfigPath = homeFile(".warddirectory-smartystreets.json")
+var addressCachePath = homeFile(".warddirectory-addresscache.json")
+
+// a membership file to read, by name and contents
+type MembershipFile struct {
+	Name string
+	Data []byte
+}
+
+// what happened while generating a directory
+type GenerateResult struct {
+	PDF      []byte
+	Rounds   int
+	Changes  *EditionChanges
+	Marked   int
+	Baseline string
+}
+
+// a Generator hands out the settings for each run, starting from the
+// defaults
+// the defaults are never changed once it is made, so any number of
+// runs can use it at once; each run gets its own Directory with its
+// own copies of the fonts, since fonts record the glyphs a run uses
+// the web interface also keeps its uploaded data here, and the
+// overrides file is only changed while holding overridesLock
+type Generator struct {
+	defaults *Directory
+
+	session       session
+	overridesLock sync.Mutex
+}
+
+// load the default settings
+func NewGenerator() (*Generator, error) {
+	defaults := new(Directory)
+	if err := json.Unmarshal(dataFiles["default.json"], defaults); err != nil {
+		return nil, fmt.Errorf("Unable to parse default config file: %v", err)
+	}
+	defaults.ComputeImplicitFields()
+	defaults.Roman = FontList["times-roman"]
+	defaults.Bold = FontList["times-bold"]
+	return &Generator{defaults: defaults}, nil
+}
+
+// a fresh copy of the default settings
+func (gen *Generator) Defaults() *Directory {
+	return gen.defaults.Copy()
+}
+
+// get the settings ready to use once they are loaded
+func (gen *Generator) Prepare(config *Directory) {
+	// set the typewriter font
+	if font, present := FontList[config.EmailFont]; present {
+		config.Typewriter = font.Copy()
+	} else {
+		config.Typewriter = FontList[FallbackTypewriter].Copy()
+	}
+	config.CompileRegexps()
+	config.CleanPrivacy()
+	config.ComputeImplicitFields()
+}
+
+// load a settings file saved by “Export settings”, on top of the defaults
+func (gen *Generator) ReadSettings(path string) (*Directory, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := gen.Defaults()
+	if err = json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("Parsing the settings in %s: %v", path, err)
+	}
+	config.Author = "Local clerk"
+	gen.Prepare(config)
+	return config, nil
+}
+
+// find the right importer for the data and use it
+func (dir *Directory) ImportFamilies(data []byte) ([]*membership.Family, *membership.ParseReport, error) {
+	profiles, err := LoadProfiles()
+	if err != nil {
+		return nil, new(membership.ParseReport), err
+	}
+	opts := &membership.Options{
+		Profiles:          profiles,
+		ExtractionProfile: dir.ExtractionProfile,
+		ColumnMapping:     dir.ColumnMapping,
+	}
+	return membership.Import(opts, data)
+}
+
+// read and combine membership files and clean up the addresses
+// files are listed in order of preference, as for MergeFamilies
+func (dir *Directory) ReadMembership(files []*MembershipFile) error {
+	var sources []*membership.Source
+	for _, file := range files {
+		source := &membership.Source{Name: file.Name}
+		var err error
+		source.Families, source.Report, err = dir.ImportFamilies(file.Data)
+		if err != nil {
+			return fmt.Errorf("parsing families from %s: %v", file.Name, err)
+		}
+		sources = append(sources, source)
+	}
+
+	// combine them
+	dir.Families, dir.Report = membership.MergeFamilies(sources)
+	if err := cleanup.Addresses(dir.Families, smartystreetConfigPath, addressCachePath); err != nil {
+		return fmt.Errorf("cleaning up addresses: %v", err)
+	}
+	return nil
+}
+
+// read a file to compare against when marking new households
+// it is cleaned up the same way as the membership data so the two
+// can be compared
+func (dir *Directory) ReadBaseline(file *MembershipFile) ([]*membership.Family, error) {
+	baseline, _, err := dir.ImportFamilies(file.Data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing families from baseline file %s: %v", file.Name, err)
+	}
+
+	if err = cleanup.Addresses(baseline, smartystreetConfigPath, addressCachePath); err != nil {
+		return nil, fmt.Errorf("cleaning up baseline addresses: %v", err)
+	}
+	return baseline, nil
+}
+
+// generate the directory from the families that have been loaded
+// the families are compared with the edition saved before they were
+// loaded, and if new households are to be marked, they are compared
+// with the baseline, or with that edition if the baseline is nil
+// once the PDF is made, the families are saved as a new edition
+// unless they are the same as the latest one
+func (dir *Directory) Generate(baseline []*membership.Family, baselineName string) (*GenerateResult, error) {
+	result := new(GenerateResult)
+
+	// editions never record what households asked not to publish,
+	// and changes to those details are not reported
+	dir.ApplyPrivacy()
+
+	// compare with the last edition, and take a snapshot of this
+	// one before the families are prepared for printing
+	previous := dir.Previous
+	if previous != nil {
+		result.Changes = dir.CompareEdition(previous)
+	}
+
+	// flag households that are not in the baseline
+	if dir.MarkNewHouseholds {
+		if baseline == nil && previous != nil {
+			baseline = previous.Families
+			baselineName = "the directory generated on " + previous.Saved.Format("January 2, 2006 at 3:04 PM")
+		}
+		if baseline != nil {
+			result.Marked = dir.MarkNew(baseline)
+			result.Baseline = baselineName
+		}
+	}
+	snapshot, err := dir.EncodeEdition()
+	if err != nil {
+		return nil, fmt.Errorf("encoding the edition: %v", err)
+	}
+
+	if result.PDF, result.Rounds, err = dir.MakeDirectory(); err != nil {
+		return nil, err
+	}
+
+	// the directory is done, so save it as the latest edition
+	if err = SaveNewEdition(snapshot, time.Now()); err != nil {
+		log.Printf("Generate: saving the edition: %v", err)
+	}
+	return result, nil
+}
+
+// lay out the families and make the PDF file
+// also returns the number of rounds of trial layouts it took to find
+// the font size
+func (dir *Directory) MakeDirectory() (pdf []byte, rounds int, err error) {
+	if err = dir.PrepareFamilies(); err != nil {
+		return nil, 0, fmt.Errorf("preparing families: %v", err)
+	}
+
+	// format families
+	dir.FormatFamilies()
+
+	// find the font size
+	if rounds, err = dir.FindFontSize(); err != nil {
+		return nil, rounds, fmt.Errorf("finding font size: %v", err)
+	}
+	log.Printf("Found font size %.3f in %d rounds of trial layouts, %d at a time", dir.FontSize, rounds, runtime.GOMAXPROCS(0))
+
+	// render the header and footer
+	dir.RenderHeader()
+	dir.RenderFooter()
+
+	// render the family listings
+	dir.SplitIntoLines()
+	dir.RenderColumns()
+
+	// generate the PDF file
+	if pdf, err = dir.MakePDF(); err != nil {
+		return nil, rounds, fmt.Errorf("making the PDF: %v", err)
+	}
+	return pdf, rounds, nil
+}
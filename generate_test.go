@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/russross/warddirectory/membership"
+)
+
+// what a run could change in the shared fonts
+func fontState() string {
+	var names []string
+	for name := range FontList {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out string
+	for _, name := range names {
+		font := FontList[name]
+		out += fmt.Sprintf("%s %d %d %d %d\n", name, font.FirstChar, font.LastChar, len(font.NameToCode), len(font.CodePointToName))
+	}
+	return out
+}
+
+// run with -race to check that runs share nothing they change
+func TestConcurrentDirectories(t *testing.T) {
+	gen, err := NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fonts := fontState()
+	defaults, err := json.Marshal(gen.Defaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const runs = 4
+	sizes := make([]float64, runs)
+	errs := make([]error, runs)
+	var wg sync.WaitGroup
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			dir := gen.Defaults()
+			gen.Prepare(dir)
+			dir.Families = privacyFamilies()
+			dir.Report = new(membership.ParseReport)
+			_, _, errs[i] = dir.MakeDirectory()
+			sizes[i] = dir.FontSize
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < runs; i++ {
+		if errs[i] != nil {
+			t.Errorf("run %d: %v", i, errs[i])
+		} else if sizes[i] != sizes[0] {
+			t.Errorf("run %d: font size %.3f, but run 0 found %.3f", i, sizes[i], sizes[0])
+		}
+	}
+	if fontState() != fonts {
+		t.Errorf("the shared fonts were changed")
+	}
+	after, err := json.Marshal(gen.Defaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(defaults) {
+		t.Errorf("the default settings were changed")
+	}
+	if gen.defaults.Families != nil || gen.defaults.Entries != nil || gen.defaults.FontSize != 0 {
+		t.Errorf("the defaults were used for a run")
+	}
+}
@@ -0,0 +1,16 @@
+//
+// Household files
+// Code to save the current list of families as a household file
+//
+
+package main
+
+import (
+	"github.com/russross/warddirectory/membership"
+)
+
+// encode the current list of families as a household file
+func (dir *Directory) ExportHouseholds() ([]byte, error) {
+	dir.ApplyPrivacy()
+	return membership.EncodeHouseholds(dir.Families)
+}
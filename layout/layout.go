@@ -0,0 +1,212 @@
+//
+// Page layout
+// The settings and working state for laying out the pages of a
+// directory and writing them as a PDF file
+//
+
+// Package layout sets boxes of text into lines and columns, finds the
+// largest font size that fits everything on the pages, and renders
+// the result as PDF content or SVG previews.
+package layout
+
+import (
+	"time"
+
+	"github.com/russross/warddirectory/font"
+	"github.com/russross/warddirectory/pdf"
+)
+
+const (
+	FontSizePrecision         = 0.01
+	StartingFontSize  float64 = 10.0
+	MinimumFontSize   float64 = 1.0
+	MaximumFontSize   float64 = 100.0
+)
+
+// a single chunk of text made up of glyphs
+type Box struct {
+	Font     *font.Metrics
+	Original string
+	Width    float64
+	Command  string
+	JoinNext bool
+	Penalty  int
+}
+
+// the page settings, fonts, and entries to lay out, and the results
+// the configured values are saved with the rest of the settings
+type Layout struct {
+	// configured values
+	Title                       string
+	DateFormat                  string
+	Disclaimer                  string
+	TitleFontSize               float64
+	HeaderFontSize              float64
+	FooterLeft                  string
+	FooterCenter                string
+	FooterRight                 string
+	FooterFontSize              float64
+	PageWidth                   float64
+	PageHeight                  float64
+	TopMargin                   float64
+	BottomMargin                float64
+	LeftMargin                  float64
+	RightMargin                 float64
+	Pages                       int
+	ColumnsPerPage              int
+	ColumnSep                   float64
+	LeadingMultiplier           float64
+	MinimumSpaceMultiplier      float64
+	MinimumLineHeightMultiplier float64
+	FirstLineDedentMultiplier   float64
+
+	// fonts
+	Roman      *font.Metrics `json:"-" schema:"-"`
+	Bold       *font.Metrics `json:"-" schema:"-"`
+	Typewriter *font.Metrics `json:"-" schema:"-"`
+
+	// the entries to lay out, one list of boxes each,
+	// and a note to center below the footer, if any
+	Entries [][]*Box `json:"-" schema:"-"`
+	Legend  string   `json:"-" schema:"-"`
+
+	// computed values
+	ColumnWidth  float64 `json:"-" schema:"-"`
+	ColumnHeight float64 `json:"-" schema:"-"`
+	ColumnCount  int     `json:"-" schema:"-"`
+
+	// processed values
+	Linebreaks   [][]int    `json:"-" schema:"-"`
+	Columnbreaks []int      `json:"-" schema:"-"`
+	Lines        [][][]*Box `json:"-" schema:"-"`
+	FontSize     float64    `json:"-" schema:"-"`
+	Columns      []string   `json:"-" schema:"-"`
+	Header       string     `json:"-" schema:"-"`
+	Footer       string     `json:"-" schema:"-"`
+}
+
+// compute the size of the columns from the page settings
+func (l *Layout) ComputeColumns() {
+	l.ColumnCount = l.ColumnsPerPage * l.Pages
+	l.ColumnWidth = l.PageWidth
+	l.ColumnWidth -= l.LeftMargin
+	l.ColumnWidth -= l.RightMargin
+	l.ColumnWidth -= l.ColumnSep * float64(l.ColumnsPerPage-1)
+	l.ColumnWidth /= float64(l.ColumnsPerPage)
+	l.ColumnHeight = l.PageHeight
+	l.ColumnHeight -= l.TopMargin
+	l.ColumnHeight -= l.BottomMargin
+}
+
+// clear everything except the settings and fonts
+func (l *Layout) Reset() {
+	l.Entries = nil
+	l.Legend = ""
+	l.Linebreaks = nil
+	l.Columnbreaks = nil
+	l.Lines = nil
+	l.FontSize = 0.0
+	l.Columns = nil
+	l.Header = ""
+	l.Footer = ""
+}
+
+// build a complete PDF file from the rendered header, columns, and footer
+// info is the document information dictionary, such as the title and
+// author; the creation and modification dates are filled in here
+func (l *Layout) MakePDF(info pdf.Map) (data []byte, err error) {
+	// make the PDF file
+	var doc pdf.Document
+
+	// build the info section
+	mst := time.FixedZone("MST", -7*3600)
+	timestamp := time.Now().In(mst).Format("20060102150405-0700")
+	timestamp = "D:" + timestamp[:17] + "'" + timestamp[17:19] + "'" + timestamp[19:]
+	info["CreationDate"] = pdf.String(timestamp)
+	info["ModDate"] = pdf.String(timestamp)
+	info_ref := doc.TopLevelObject(info)
+
+	// build the root catalog
+	catalog := pdf.Map{
+		"Type": pdf.Name("Catalog"),
+	}
+	catalog_ref := doc.TopLevelObject(catalog)
+
+	// the list of fonts, shared by all pages
+	fontResource := pdf.Map{}
+	fontResource_ref := doc.TopLevelObject(fontResource)
+
+	// build the fonts
+	// only add fonts that were actually used
+	var roman_ref, bold_ref, typewriter_ref pdf.Ref
+	if l.Roman.LastChar > 0 {
+		if roman_ref, err = l.Roman.Embed(&doc); err != nil {
+			return
+		}
+		fontResource[l.Roman.Label] = roman_ref
+	}
+	if l.Bold.LastChar > 0 {
+		if bold_ref, err = l.Bold.Embed(&doc); err != nil {
+			return
+		}
+		fontResource[l.Bold.Label] = bold_ref
+	}
+	if l.Typewriter.LastChar > 0 {
+		if typewriter_ref, err = l.Typewriter.Embed(&doc); err != nil {
+			return
+		}
+		fontResource[l.Typewriter.Label] = typewriter_ref
+	}
+
+	// build the list of pages
+	kids := pdf.Slice(nil)
+	pages := pdf.Map{
+		"Type":  pdf.Name("Pages"),
+		"Count": pdf.Number(l.Pages),
+	}
+	pages_ref := doc.TopLevelObject(pages)
+	catalog["Pages"] = pages_ref
+
+	// build the actual page objects
+	col := 0
+	for i := 0; i < l.Pages; i++ {
+		// first get the contents of this page
+		text := l.Header
+		for i := 0; i < l.ColumnsPerPage; i++ {
+			text += l.Columns[col]
+			col++
+		}
+		text += l.Footer
+		contents := &pdf.Stream{
+			Map:  pdf.Map{},
+			Data: []byte(text),
+		}
+		contents_ref := doc.TopLevelObject(contents)
+
+		page := pdf.Map{
+			"Type": pdf.Name("Page"),
+			"MediaBox": pdf.Slice{
+				pdf.Number(0),
+				pdf.Number(0),
+				pdf.Number(l.PageWidth),
+				pdf.Number(l.PageHeight),
+			},
+			"Rotate": pdf.Number(0),
+			"Parent": pages_ref,
+			"Resources": pdf.Map{
+				"ProcSet": pdf.Slice{
+					pdf.Name("PDF"),
+					pdf.Name("ImageB"),
+					pdf.Name("Text"),
+				},
+				"Font": fontResource_ref,
+			},
+			"Contents": contents_ref,
+		}
+		page_ref := doc.TopLevelObject(page)
+		kids = append(kids, page_ref)
+	}
+	pages["Kids"] = kids
+
+	return doc.Render(info_ref, catalog_ref)
+}
@@ -0,0 +1,96 @@
+//
+// Page previews
+// Code to draw the laid out pages as SVG images, so the effect of a
+// change to the settings can be seen without making the PDF file
+//
+
+package layout
+
+import (
+	"fmt"
+	"html"
+
+	"github.com/russross/warddirectory/font"
+)
+
+// the SVG font attributes that best match one of the directory's fonts
+func (l *Layout) svgFont(f *font.Metrics) string {
+	switch f {
+	case l.Bold:
+		return `font-family="Times New Roman, Times, serif" font-weight="bold"`
+	case l.Typewriter:
+		return `font-family="Courier New, Courier, monospace"`
+	default:
+		return `font-family="Times New Roman, Times, serif"`
+	}
+}
+
+// draw placed lines as SVG text
+// each box is stretched or squeezed to the width it has in the PDF file,
+// so the lines break and fill the same way even if the fonts differ
+func (l *Layout) svgLines(lines []*placedLine) string {
+	text := ""
+	for _, line := range lines {
+		x := line.X
+		for _, box := range line.Boxes {
+			width := box.Width / 1000.0 * line.Size
+			text += fmt.Sprintf(`<text x="%.3f" y="%.3f" font-size="%.3f" %s textLength="%.3f" lengthAdjust="spacingAndGlyphs" xml:space="preserve">%s</text>`+"\n",
+				x, l.PageHeight-line.Y, line.Size, l.svgFont(box.Font), width, html.EscapeString(box.Original))
+			x += width
+		}
+	}
+	return text
+}
+
+// draw a horizontal rule across the page at the given height
+func (l *Layout) svgRule(y float64) string {
+	return fmt.Sprintf(`<line x1="%.3f" y1="%.3f" x2="%.3f" y2="%.3f" stroke="black" stroke-width="0.5"/>`+"\n",
+		l.LeftMargin, l.PageHeight-y, l.PageWidth-l.RightMargin, l.PageHeight-y)
+}
+
+// draw the laid out pages as SVG images, one per page
+// this must follow FindFontSize and SplitIntoLines
+// the columns are outlined so the margins can be seen
+func (l *Layout) RenderSVG() (pages []string) {
+	header, headerRule := l.layoutHeader()
+	footer, footerRule := l.layoutFooter()
+
+	for page := 0; page < l.Pages; page++ {
+		svg := fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%.3f" height="%.3f" viewBox="0 0 %.3f %.3f">`+"\n",
+			l.PageWidth, l.PageHeight, l.PageWidth, l.PageHeight)
+		svg += fmt.Sprintf(`<rect x="0" y="0" width="%.3f" height="%.3f" fill="white"/>`+"\n", l.PageWidth, l.PageHeight)
+
+		// the header
+		svg += l.svgLines(header)
+		svg += l.svgRule(headerRule)
+
+		// the columns on this page
+		for number := 0; number < l.ColumnsPerPage; number++ {
+			x := l.LeftMargin + (l.ColumnWidth+l.ColumnSep)*float64(number)
+			svg += fmt.Sprintf(`<rect x="%.3f" y="%.3f" width="%.3f" height="%.3f" fill="none" stroke="#9cf" stroke-width="0.5" stroke-dasharray="2,2"/>`+"\n",
+				x, l.TopMargin, l.ColumnWidth, l.ColumnHeight)
+
+			i := page*l.ColumnsPerPage + number
+			if i >= len(l.Columnbreaks) {
+				continue
+			}
+			var column [][][]*Box
+			if i+1 < len(l.Columnbreaks) {
+				column = l.Lines[l.Columnbreaks[i]:l.Columnbreaks[i+1]]
+			} else {
+				column = l.Lines[l.Columnbreaks[i]:]
+			}
+			svg += l.svgLines(l.layoutColumn(column, number))
+		}
+
+		// the footer
+		if len(footer) > 0 {
+			svg += l.svgLines(footer)
+			svg += l.svgRule(footerRule)
+		}
+
+		svg += "</svg>\n"
+		pages = append(pages, svg)
+	}
+	return pages
+}
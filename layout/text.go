@@ -0,0 +1,799 @@
+//
+// Text processing
+// Code to render strings using fonts,
+// break entries into lines, break lists of entries into columns
+// find the optimal font size, etc.
+//
+
+package layout
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/russross/warddirectory/font"
+)
+
+// given a string, render it into PDF syntax using font metric data
+// this also computes the width of the box in units equal to 1/1000th of a point
+// if spacecompress != 1.0, space widths are adjusted by the given factor
+func MakeBox(f *font.Metrics, text string, spacecompress float64) (box *Box) {
+	// find the list of glyphs, merging ligatures when possible
+	var glyphs []*font.GlyphMetrics
+	for _, ch := range text {
+		glyph := f.GetGlyph(ch)
+
+		// see if this can be combined with the previous glyph
+		count := len(glyphs)
+		if count > 0 {
+			if lig, present := glyphs[count-1].Ligatures[glyph.Name]; present {
+				glyphs = glyphs[:count-1]
+				glyph = f.Glyphs[lig]
+			}
+		}
+		glyphs = append(glyphs, glyph)
+	}
+
+	// now compute the total width, including kerning
+	var width float64
+	cmd := ""
+	pending := ""
+	simple := true
+	for i, glyph := range glyphs {
+		var kern float64
+		if i+1 < len(glyphs) {
+			kern = float64(glyph.Kerning[glyphs[i+1].Name])
+		}
+
+		// do we need to "kern" this space to squish it?
+		if spacecompress != 1.0 && glyph.Code == ' ' {
+			kern -= float64(glyph.Width) - float64(glyph.Width)*spacecompress
+		}
+		width += float64(glyph.Width) + kern
+
+		pending += f.GetCode(glyph)
+		if kern != 0 {
+			if float64(int(kern)) == kern {
+				cmd += fmt.Sprintf("(%s)%d", pending, -int(kern))
+			} else {
+				cmd += fmt.Sprintf("(%s)%.3f", pending, -kern)
+			}
+			pending = ""
+			simple = false
+		}
+	}
+	if pending != "" {
+		cmd += fmt.Sprintf("(%s)", pending)
+	}
+	if simple {
+		cmd = cmd + " Tj"
+	} else {
+		cmd = "[" + cmd + "] TJ"
+	}
+
+	return &Box{
+		Font:     f,
+		Original: text,
+		Width:    width,
+		Command:  cmd,
+	}
+}
+
+// a sequence of items to be broken into chunks (lines or columns)
+// Cost gives the cost of a chunk from item a up to (not including) b
+type Breakable interface {
+	Len() int
+	Cost(a, b int, first, last bool) float64
+}
+
+// find the breaks with the lowest total cost
+// the result is the index of the first item in each chunk
+//
+// this is a shortest path through the possible breaks, in the style of
+// Knuth and Plass, working back from the end: best[from] is the lowest
+// cost of breaking everything from item from on, found by trying each
+// chunk that starts there, shortest first, until one no longer fits
+// only one cost is kept per item, so memory is linear in the length
+func Break(sequence Breakable) (startofeachchunk []int) {
+	dim := sequence.Len()
+	if dim == 0 {
+		return nil
+	}
+
+	// best[dim] is the empty chunk at the end, which costs nothing
+	best := make([]float64, dim+1)
+	nextchunk := make([]int, dim+1)
+	for from := dim - 1; from >= 0; from-- {
+		best[from] = math.Inf(1)
+		nextchunk[from] = -1
+		for to := from + 1; to <= dim; to++ {
+			cost := sequence.Cost(from, to, from == 0, to == dim)
+			if math.IsInf(cost, 1) {
+				// adding more will not make this fit any better
+				break
+			}
+			cost += best[to]
+			if cost < best[from] {
+				best[from], nextchunk[from] = cost, to
+			}
+		}
+	}
+
+	if math.IsInf(best[0], 1) {
+		return nil
+	}
+
+	for from := 0; from < dim; from = nextchunk[from] {
+		startofeachchunk = append(startofeachchunk, from)
+	}
+	return
+}
+
+// the boxes of a single entry, to be broken into lines
+type BoxSlice struct {
+	Boxes  []*Box
+	Layout *Layout
+}
+
+func (elt *BoxSlice) Len() int {
+	return len(elt.Boxes)
+}
+
+func (elt *BoxSlice) Cost(a, b int, first, last bool) float64 {
+	words := elt.Boxes[a:b]
+
+	// no space after the end of this sequence of words?
+	if words[len(words)-1].JoinNext {
+		return math.MaxFloat64
+	}
+
+	// see if the line fits
+	var spaces float64
+	var cost float64
+	for i, box := range words {
+		cost += float64(box.Width)
+		if !box.JoinNext && i+1 < len(words) {
+			spaces += 1.0
+		}
+	}
+	spacesize := float64(elt.Layout.Roman.Glyphs["space"].Width)
+	maxwidth := cost + spaces*spacesize
+	minwidth := cost + spaces*spacesize*elt.Layout.MinimumSpaceMultiplier
+
+	// if we prefer not to break here, then the penalty is the
+	// same as a completely blank line
+	width := elt.Layout.ColumnWidth * 1000.0 / elt.Layout.FontSize
+	if !first {
+		width -= elt.Layout.FirstLineDedentMultiplier * 1000.0
+	}
+	penalty := width / spacesize
+	penalty = penalty * penalty * float64(words[len(words)-1].Penalty)
+
+	switch {
+	// too long
+	case minwidth > width:
+		return math.Inf(1)
+
+	// easy fit
+	case maxwidth <= width:
+		excess := (width - maxwidth) / spacesize
+
+		// no penalty for trailing spaces on the last line
+		if last {
+			excess = 0.0
+		}
+
+		return excess*excess + penalty
+
+	// squished fit
+	default:
+		squish := (maxwidth - width) / spacesize
+		return squish*squish*squish + penalty
+	}
+}
+
+// the line-broken entries, to be broken into columns
+type EntrySlice struct {
+	Entries [][]int
+	Layout  *Layout
+}
+
+func (elt *EntrySlice) Len() int {
+	return len(elt.Entries)
+}
+
+func (elt *EntrySlice) Cost(a, b int, first, last bool) float64 {
+	entries := elt.Entries[a:b]
+	columnheight := elt.Layout.ColumnHeight * 1000.0 / elt.Layout.FontSize
+
+	// count up the number of lines
+	count := 0
+	for _, entry := range entries {
+		count += len(entry)
+	}
+
+	// units are normalized to one line per 1000 columnheight units
+	squeeze := ((columnheight / 1000.0) - 1.0) / (float64(count-1) * elt.Layout.LeadingMultiplier)
+
+	// forbid squeezing too much
+	if squeeze < elt.Layout.MinimumLineHeightMultiplier {
+		return math.Inf(1)
+	}
+
+	extralines := ((columnheight / 1000.0) - 1.0) -
+		(float64(count-1) * elt.Layout.LeadingMultiplier)
+
+	// squishing is worse than stretching
+	if extralines < 0 {
+		return -extralines * extralines * extralines
+	}
+
+	// how many lines worth?
+	return extralines * extralines
+}
+
+// gather the boxes of each entry into lines using the chosen breaks
+func (l *Layout) SplitIntoLines() {
+	firstlinewidth := l.ColumnWidth * 1000.0 / l.FontSize
+	linewidth := firstlinewidth - l.FirstLineDedentMultiplier*1000.0
+	for i, entry := range l.Entries {
+		var newentry [][]*Box
+		breaks := l.Linebreaks[i]
+		for j, start := range breaks {
+			var line []*Box
+			if j+1 < len(breaks) {
+				line = entry[start:breaks[j+1]]
+			} else {
+				line = entry[start:]
+			}
+
+			width := firstlinewidth
+			if j > 0 {
+				width = linewidth
+			}
+
+			line = l.SimplifyLine(line, width)
+			newentry = append(newentry, line)
+		}
+
+		l.Lines = append(l.Lines, newentry)
+	}
+}
+
+// insert explicit spaces into a line
+func (l *Layout) SimplifyLine(boxes []*Box, linewidth float64) (simple []*Box) {
+	// count up the spaces and the total line width
+	var width, spaces float64
+	for i, box := range boxes {
+		width += float64(box.Width)
+		if !box.JoinNext && i+1 < len(boxes) {
+			spaces += 1
+		}
+	}
+	spacefactor := float64(1.0)
+	spacesize := float64(l.Roman.Glyphs["space"].Width)
+	maxwidth := width + spaces*spacesize
+
+	if maxwidth > linewidth {
+		// how much do we need to squeeze each space?
+		extra := maxwidth - linewidth
+		spacefactor = (spacesize - extra/spaces) / spacesize
+	}
+
+	for i := 0; i < len(boxes); i++ {
+		box := boxes[i]
+
+		// last box of the line?
+		if i+1 == len(boxes) {
+			simple = append(simple, box)
+			break
+		}
+
+		next := boxes[i+1]
+
+		switch {
+		// nothing to be done
+		case box.JoinNext && box.Font != next.Font:
+			simple = append(simple, box)
+
+		// simple merger
+		case box.JoinNext:
+			join := next.JoinNext
+			boxes[i+1] = MakeBox(box.Font, box.Original+next.Original, spacefactor)
+			boxes[i+1].JoinNext = join
+
+		// same font with a space between
+		case box.Font == next.Font:
+			join := next.JoinNext
+			boxes[i+1] = MakeBox(box.Font, box.Original+" "+next.Original, spacefactor)
+			boxes[i+1].JoinNext = join
+
+		// roman followed by anything
+		case box.Font == l.Roman:
+			join := box.JoinNext
+			box = MakeBox(box.Font, box.Original+" ", spacefactor)
+			box.JoinNext = join
+			simple = append(simple, box)
+
+		// anything followed by roman
+		case next.Font == l.Roman:
+			join := next.JoinNext
+			boxes[i+1] = MakeBox(next.Font, " "+next.Original, spacefactor)
+			boxes[i+1].JoinNext = join
+			simple = append(simple, box)
+
+		// bold followed by anything
+		case box.Font == l.Bold:
+			join := box.JoinNext
+			box = MakeBox(box.Font, box.Original+" ", spacefactor)
+			box.JoinNext = join
+			simple = append(simple, box)
+
+		// anything followed by bold
+		case next.Font == l.Bold:
+			join := next.JoinNext
+			boxes[i+1] = MakeBox(next.Font, " "+next.Original, spacefactor)
+			boxes[i+1].JoinNext = join
+			simple = append(simple, box)
+
+		default:
+			panic("Can't get here")
+		}
+	}
+
+	return
+}
+
+// render the lines of every column as PDF content
+func (l *Layout) RenderColumns() {
+	// split the list of entries into columns
+	for i, start := range l.Columnbreaks {
+		var column [][][]*Box
+		if i+1 < len(l.Columnbreaks) {
+			column = l.Lines[start:l.Columnbreaks[i+1]]
+		} else {
+			column = l.Lines[start:]
+		}
+
+		text := l.RenderColumn(column, i%l.ColumnsPerPage)
+		l.Columns = append(l.Columns, text)
+	}
+}
+
+// a line of boxes placed on the page, set at the given font size
+type placedLine struct {
+	X     float64
+	Y     float64
+	Size  float64
+	Boxes []*Box
+}
+
+// find where each line of a column goes
+func (l *Layout) layoutColumn(entries [][][]*Box, number int) (lines []*placedLine) {
+	// find the top left corner
+	x := l.LeftMargin + (l.ColumnWidth+l.ColumnSep)*float64(number)
+	y := l.BottomMargin + l.ColumnHeight - l.FontSize
+
+	// what is the starting position for an indented line?
+	xi := x + l.FontSize*l.FirstLineDedentMultiplier
+
+	// how many lines are there?
+	count := 0
+	for _, entry := range entries {
+		count += len(entry)
+	}
+
+	// how tall must each line be to exactly fill the column?
+	// strip off the top line, divide the remaining space evenly
+	dy := (l.ColumnHeight - l.FontSize) / float64(count-1)
+
+	// now walk through the entries and place each line
+	for _, entry := range entries {
+		for i, line := range entry {
+			elt := &placedLine{X: x, Y: y, Size: l.FontSize, Boxes: line}
+			if i > 0 {
+				elt.X = xi
+			}
+			lines = append(lines, elt)
+			y -= dy
+		}
+	}
+
+	return
+}
+
+func (l *Layout) RenderColumn(entries [][][]*Box, number int) string {
+	rendered := "BT\n"
+	for _, line := range l.layoutColumn(entries, number) {
+		rendered += fmt.Sprintf("1 0 0 1 %.3f %.3f Tm\n", line.X, line.Y)
+
+		// render each box with its font
+		for j, box := range line.Boxes {
+			if j > 0 {
+				rendered += " "
+			}
+			rendered += fmt.Sprintf("/%s %.3f Tf ", box.Font.Label, line.Size)
+			rendered += box.Command
+		}
+
+		rendered += "\n"
+	}
+	rendered += "ET\n"
+
+	return rendered
+}
+
+// render lines that each hold a single box, as in the header and footer
+func renderPlacedLines(lines []*placedLine) string {
+	text := ""
+	for _, line := range lines {
+		box := line.Boxes[0]
+		text += fmt.Sprintf("1 0 0 1 %.3f %.3f Tm\n", line.X, line.Y)
+		text += fmt.Sprintf("/%s %.3f Tf %s\n", box.Font.Label, line.Size, box.Command)
+	}
+	return text
+}
+
+// render a horizontal rule across the page at the given height
+func (l *Layout) renderRule(y float64) string {
+	length := l.PageWidth - l.RightMargin - l.LeftMargin
+	text := "q\n"
+	text += fmt.Sprintf("1 0 0 1 %.3f %.3f cm\n", l.LeftMargin, y)
+	text += fmt.Sprintf("[]0 d 0 J 0.5 w 0 0 m %.3f 0 l s\n", length)
+	text += "Q\n0 g 0 G\n"
+	return text
+}
+
+// find where the date, title, and disclaimer go, and the rule below them
+func (l *Layout) layoutHeader() (lines []*placedLine, hrule float64) {
+	title := MakeBox(l.Bold, l.Title, 1.0)
+	mst := time.FixedZone("MST", -7*3600)
+	date := MakeBox(l.Roman, time.Now().In(mst).Format(l.DateFormat), 1.0)
+	useonly := MakeBox(l.Roman, l.Disclaimer, 1.0)
+
+	// figure out where the hrule goes
+	hrule = l.PageHeight - l.TopMargin
+	y := hrule + l.FontSize*(1.0-float64(l.Roman.CapHeight)/1000.0)
+
+	lines = []*placedLine{
+		// the date
+		{X: l.LeftMargin, Y: y, Size: l.HeaderFontSize, Boxes: []*Box{date}},
+
+		// the title
+		{X: (l.PageWidth - title.Width/1000.0*l.TitleFontSize) / 2.0, Y: y, Size: l.TitleFontSize, Boxes: []*Box{title}},
+
+		// the disclaimer
+		{X: l.PageWidth - l.RightMargin - useonly.Width/1000.0*l.HeaderFontSize, Y: y, Size: l.HeaderFontSize, Boxes: []*Box{useonly}},
+	}
+	return
+}
+
+// render the title, date, and disclaimer as PDF content
+func (l *Layout) RenderHeader() {
+	lines, hrule := l.layoutHeader()
+
+	text := "0 g 0 G\n"
+	text += "BT\n"
+	text += renderPlacedLines(lines)
+	text += "ET\n"
+
+	// place the hrule
+	text += l.renderRule(hrule)
+
+	l.Header = text
+}
+
+// find where the footer text goes, and the rule above it
+// if there is no footer, lines is empty
+func (l *Layout) layoutFooter() (lines []*placedLine, hrule float64) {
+	// the note below the footer, if any
+	var legend *Box
+	if l.Legend != "" {
+		legend = MakeBox(l.Roman, l.Legend, 1.0)
+	}
+
+	if l.FooterLeft == "" && l.FooterCenter == "" && l.FooterRight == "" && legend == nil {
+		return nil, 0
+	}
+
+	// figure out where the hrule goes
+	hrule = l.BottomMargin - l.FontSize*(1.0-float64(l.Roman.CapHeight)/1000.0)
+	y := hrule - l.FooterFontSize
+
+	if l.FooterLeft != "" {
+		left := MakeBox(l.Roman, l.FooterLeft, 1.0)
+		lines = append(lines, &placedLine{X: l.LeftMargin, Y: y, Size: l.FooterFontSize, Boxes: []*Box{left}})
+	}
+	if l.FooterCenter != "" {
+		center := MakeBox(l.Roman, l.FooterCenter, 1.0)
+		lines = append(lines, &placedLine{
+			X:     (l.PageWidth - center.Width/1000.0*l.FooterFontSize) / 2.0,
+			Y:     y,
+			Size:  l.FooterFontSize,
+			Boxes: []*Box{center},
+		})
+	}
+	if l.FooterRight != "" {
+		right := MakeBox(l.Roman, l.FooterRight, 1.0)
+		lines = append(lines, &placedLine{
+			X:     l.PageWidth - l.RightMargin - right.Width/1000.0*l.FooterFontSize,
+			Y:     y,
+			Size:  l.FooterFontSize,
+			Boxes: []*Box{right},
+		})
+	}
+	if legend != nil {
+		// centered on the next line
+		lines = append(lines, &placedLine{
+			X:     (l.PageWidth - legend.Width/1000.0*l.FooterFontSize) / 2.0,
+			Y:     y - l.FooterFontSize*l.LeadingMultiplier,
+			Size:  l.FooterFontSize,
+			Boxes: []*Box{legend},
+		})
+	}
+	return
+}
+
+// render the footer and legend as PDF content
+func (l *Layout) RenderFooter() {
+	lines, hrule := l.layoutFooter()
+	if len(lines) == 0 {
+		l.Footer = ""
+		return
+	}
+
+	text := "0 g 0 G\n"
+	text += "BT\n"
+	text += renderPlacedLines(lines)
+	text += "ET\n"
+
+	// place the hrule
+	text += l.renderRule(hrule)
+
+	l.Footer = text
+}
+
+// break the entries into lines and columns at the current font size
+// and report whether everything fit
+func (l *Layout) DoLayout() (success bool) {
+	p := l.probe(l.FontSize, nil)
+	l.Linebreaks = p.linebreaks
+	l.Columnbreaks = p.columnbreaks
+	return p.fits
+}
+
+// the line and column breaks at one font size
+type probe struct {
+	fontSize     float64
+	linebreaks   [][]int
+	columnbreaks []int
+	fits         bool
+}
+
+// the width of each entry set on a single line with normal spaces,
+// in the units used by BoxSlice.Cost, or zero if the entry cannot
+// be treated that way
+//
+// an entry narrower than the line is always set on one line, since
+// that costs nothing and every other way of breaking it costs more;
+// that is only true if breaking after its last box carries no penalty
+// and no box has a negative width
+// the same entry is then on one line at every smaller size, so the
+// widths are found once for the whole search
+func (l *Layout) oneLineWidths() []float64 {
+	spacesize := float64(l.Roman.Glyphs["space"].Width)
+	widths := make([]float64, len(l.Entries))
+	for i, entry := range l.Entries {
+		if len(entry) == 0 || entry[len(entry)-1].JoinNext || entry[len(entry)-1].Penalty != 0 {
+			continue
+		}
+
+		// add it up the same way BoxSlice.Cost does
+		var spaces float64
+		var width float64
+		for j, box := range entry {
+			if box.Width < 0 {
+				width = 0
+				break
+			}
+			width += float64(box.Width)
+			if !box.JoinNext && j+1 < len(entry) {
+				spaces += 1.0
+			}
+		}
+		if width > 0 {
+			widths[i] = width + spaces*spacesize
+		}
+	}
+	return widths
+}
+
+// lay out the entries at the given font size
+// this works on a copy of the layout and leaves l alone,
+// so several sizes can be tried at once
+// oneline is from oneLineWidths, or nil to break every entry
+func (l *Layout) probe(size float64, oneline []float64) *probe {
+	at := *l
+	at.FontSize = size
+	p := &probe{fontSize: size}
+
+	// do line breaking
+	linewidth := at.ColumnWidth * 1000.0 / at.FontSize
+	breaklines := &BoxSlice{
+		Layout: &at,
+	}
+	for i, entry := range at.Entries {
+		if oneline != nil && oneline[i] > 0 && oneline[i] < linewidth {
+			p.linebreaks = append(p.linebreaks, []int{0})
+			continue
+		}
+		breaklines.Boxes = entry
+		breaks := Break(breaklines)
+		p.linebreaks = append(p.linebreaks, breaks)
+	}
+
+	// do column breaking
+	breakentries := &EntrySlice{
+		Entries: p.linebreaks,
+		Layout:  &at,
+	}
+	p.columnbreaks = Break(breakentries)
+
+	// evaluate this break
+	p.fits = len(p.columnbreaks) <= at.ColumnCount && len(p.columnbreaks) > 0
+	return p
+}
+
+// lay out the entries at each of the sizes at the same time
+// nothing is kept between calls: every round of the search tries
+// sizes that no earlier round tried
+func (l *Layout) probeAll(sizes []float64, oneline []float64) []*probe {
+	results := make([]*probe, len(sizes))
+	var wg sync.WaitGroup
+	for i, size := range sizes {
+		wg.Add(1)
+		go func(i int, size float64) {
+			defer wg.Done()
+			results[i] = l.probe(size, oneline)
+		}(i, size)
+	}
+	wg.Wait()
+	return results
+}
+
+// find the largest font size at which everything fits
+// each round tries several sizes at once, one per CPU
+// rounds is the number of rounds of sizes tried at once, not the
+// number of sizes tried
+func (l *Layout) FindFontSize() (rounds int, err error) {
+	oneline := l.oneLineWidths()
+	p, rounds, err := searchFontSize(runtime.GOMAXPROCS(0), func(sizes []float64) []*probe {
+		return l.probeAll(sizes, oneline)
+	})
+	if err != nil {
+		return rounds, err
+	}
+
+	// use the layout from the best size found
+	l.FontSize = p.fontSize
+	l.Linebreaks = p.linebreaks
+	l.Columnbreaks = p.columnbreaks
+	return rounds, nil
+}
+
+// search for the largest font size that fits, trying width sizes at a
+// time with try: first stepping up or down by a factor of √2 until the
+// answer is bracketed, then splitting the bracket evenly
+//
+// while stepping, the sizes are taken in the order that a search of one
+// size at a time would try them, stopping where it would, so the
+// bracket is the same however many sizes are tried at once even if
+// fitting is not monotonic in the font size; with a width of one, the
+// whole search is the same as a plain bisection
+func searchFontSize(width int, try func(sizes []float64) []*probe) (best *probe, rounds int, err error) {
+	// the largest size known to fit and the smallest known not to,
+	// or zero if none has been found yet
+	var low, high float64
+
+	for low == 0 || high == 0 || high-low >= FontSizePrecision {
+		// pick the sizes to try this round
+		var sizes []float64
+		switch {
+		case low == 0 && high == 0:
+			// start in the middle and work out both ways
+			sizes = append(sizes, StartingFontSize)
+			up, down := StartingFontSize, StartingFontSize
+			for len(sizes) < width && (up*math.Sqrt2 <= MaximumFontSize || down/math.Sqrt2 >= MinimumFontSize) {
+				if up *= math.Sqrt2; up <= MaximumFontSize {
+					sizes = append(sizes, up)
+				}
+				if down /= math.Sqrt2; down >= MinimumFontSize && len(sizes) < width {
+					sizes = append(sizes, down)
+				}
+			}
+
+		case high == 0:
+			// find an upper bound
+			for size := low * math.Sqrt2; size <= MaximumFontSize && len(sizes) < width; size *= math.Sqrt2 {
+				sizes = append(sizes, size)
+			}
+			if len(sizes) == 0 {
+				return nil, rounds, errors.New("Exceeded maximum font size: include more data to fill up the pages")
+			}
+
+		case low == 0:
+			// find a lower bound
+			for size := high / math.Sqrt2; size >= MinimumFontSize && len(sizes) < width; size /= math.Sqrt2 {
+				sizes = append(sizes, size)
+			}
+			if len(sizes) == 0 {
+				return nil, rounds, errors.New("Exceeded minimum font size: use more pages or include less data")
+			}
+
+		default:
+			// split the bracket evenly
+			for i := 1; i <= width; i++ {
+				sizes = append(sizes, low+(high-low)*float64(i)/float64(width+1))
+			}
+		}
+
+		rounds++
+		results := try(sizes)
+
+		if low != 0 && high != 0 {
+			// narrow the bracket: the smallest size that did not fit,
+			// then the largest size below it that did
+			for _, p := range results {
+				if !p.fits && p.fontSize < high {
+					high = p.fontSize
+				}
+			}
+			for _, p := range results {
+				if p.fits && p.fontSize > low && p.fontSize < high {
+					low, best = p.fontSize, p
+				}
+			}
+		} else {
+			// step through the sizes in order
+			found := make(map[float64]*probe)
+			for _, p := range results {
+				found[p.fontSize] = p
+			}
+			if low == 0 && high == 0 {
+				if p := found[StartingFontSize]; p.fits {
+					low, best = p.fontSize, p
+				} else {
+					high = p.fontSize
+				}
+			}
+			if high == 0 {
+				for size := low * math.Sqrt2; found[size] != nil; size *= math.Sqrt2 {
+					if p := found[size]; p.fits {
+						low, best = p.fontSize, p
+					} else {
+						high = p.fontSize
+						break
+					}
+				}
+			} else if low == 0 {
+				for size := high / math.Sqrt2; found[size] != nil; size /= math.Sqrt2 {
+					if p := found[size]; p.fits {
+						low, best = p.fontSize, p
+						break
+					} else {
+						high = p.fontSize
+					}
+				}
+			}
+		}
+		if low != 0 && high != 0 && low >= high {
+			return nil, rounds, fmt.Errorf("Font size search lost track: %.3f fits but %.3f does not", low, high)
+		}
+	}
+
+	return best, rounds, nil
+}
@@ -0,0 +1,287 @@
+package layout
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/russross/warddirectory/font"
+)
+
+// the breaks as they were found with a full matrix of costs, where
+// matrix[from][to] is the best way to break the items from up to to
+func matrixBreak(sequence Breakable) (startofeachchunk []int) {
+	type breakpoint struct {
+		cost     float64
+		nextline int
+	}
+	dim := sequence.Len()
+	matrix := make([][]breakpoint, dim)
+	for i := range matrix {
+		matrix[i] = make([]breakpoint, dim)
+	}
+	for from := dim - 1; from >= 0; from-- {
+		for to := dim - 1; to >= from; to-- {
+			matrix[from][to] = breakpoint{math.Inf(1), -1}
+			for i := from; i <= to; i++ {
+				cost := sequence.Cost(from, i+1, from == 0, i+1 == dim)
+				if math.IsInf(cost, 1) {
+					break
+				}
+				if i+1 <= to {
+					cost += matrix[i+1][to].cost
+				}
+				if cost < matrix[from][to].cost {
+					matrix[from][to] = breakpoint{cost, i + 1}
+				}
+			}
+		}
+	}
+	if dim == 0 || math.IsInf(matrix[0][dim-1].cost, 1) {
+		return nil
+	}
+	for nextline := 0; nextline < dim; nextline = matrix[nextline][dim-1].nextline {
+		startofeachchunk = append(startofeachchunk, nextline)
+	}
+	return
+}
+
+// a layout with made-up entries of words of random widths
+func randomLayout(r *rand.Rand, entries int) *Layout {
+	roman := &font.Metrics{Glyphs: map[string]*font.GlyphMetrics{"space": {Width: 250}}}
+	l := &Layout{
+		Roman:                       roman,
+		ColumnWidth:                 180,
+		ColumnHeight:                700,
+		ColumnCount:                 8,
+		FontSize:                    8,
+		LeadingMultiplier:           1.1,
+		MinimumSpaceMultiplier:      0.5,
+		MinimumLineHeightMultiplier: 1.0,
+		FirstLineDedentMultiplier:   1.0,
+	}
+	for i := 0; i < entries; i++ {
+		n := 5 + r.Intn(30)
+		var entry []*Box
+		for j := 0; j < n; j++ {
+			entry = append(entry, &Box{
+				Width:    float64(500 + r.Intn(4000)),
+				Penalty:  r.Intn(3),
+				JoinNext: j+1 < n && r.Intn(10) == 0,
+			})
+		}
+		l.Entries = append(l.Entries, entry)
+	}
+	return l
+}
+
+func sameBreaks(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBreakMatchesMatrix(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 20; trial++ {
+		l := randomLayout(r, 60+r.Intn(100))
+		l.FontSize = 6 + r.Float64()*6
+
+		var lines [][]int
+		for i, entry := range l.Entries {
+			seq := &BoxSlice{Boxes: entry, Layout: l}
+			want, got := matrixBreak(seq), Break(seq)
+			if !sameBreaks(want, got) {
+				t.Errorf("trial %d, entry %d: line breaks %v, expected %v", trial, i, got, want)
+			}
+			lines = append(lines, got)
+		}
+
+		seq := &EntrySlice{Entries: lines, Layout: l}
+		want, got := matrixBreak(seq), Break(seq)
+		if !sameBreaks(want, got) {
+			t.Errorf("trial %d: column breaks %v, expected %v", trial, got, want)
+		}
+	}
+}
+
+// breaking 5,000 entries into columns; with a full matrix of costs,
+// this needed hundreds of megabytes
+func BenchmarkBreak(b *testing.B) {
+	l := randomLayout(rand.New(rand.NewSource(2)), 5000)
+	l.DoLayout()
+	seq := &EntrySlice{Entries: l.Linebreaks, Layout: l}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Break(seq)
+	}
+}
+
+// the font size search as it was before sizes were tried in parallel:
+// step up or down by √2 until the answer is bracketed, then bisect
+func sequentialFontSize(fits func(size float64) bool) (float64, error) {
+	low, high := StartingFontSize, StartingFontSize
+	if fits(StartingFontSize) {
+		for {
+			high *= math.Sqrt2
+			if high > MaximumFontSize {
+				return 0, errors.New("Exceeded maximum font size")
+			}
+			if !fits(high) {
+				break
+			}
+			low = high
+		}
+	} else {
+		for {
+			low /= math.Sqrt2
+			if low < MinimumFontSize {
+				return 0, errors.New("Exceeded minimum font size")
+			}
+			if fits(low) {
+				break
+			}
+			high = low
+		}
+	}
+	for high-low >= FontSizePrecision {
+		size := (high + low) / 2.0
+		if fits(size) {
+			low = size
+		} else {
+			high = size
+		}
+	}
+	return low, nil
+}
+
+// try sizes against a rule instead of laying anything out
+func tryRule(fits func(size float64) bool) func(sizes []float64) []*probe {
+	return func(sizes []float64) []*probe {
+		var results []*probe
+		for _, size := range sizes {
+			results = append(results, &probe{fontSize: size, fits: fits(size)})
+		}
+		return results
+	}
+}
+
+func TestSearchFontSize(t *testing.T) {
+	rules := map[string]func(size float64) bool{
+		"small":      func(size float64) bool { return size < 3.3 },
+		"start":      func(size float64) bool { return size < 10.004 },
+		"large":      func(size float64) bool { return size < 61.7 },
+		"gap above":  func(size float64) bool { return size < 8.2 || size > 14 && size < 15 },
+		"gap below":  func(size float64) bool { return size < 6.1 && size > 5.9 || size > 7.4 && size < 12.6 },
+		"stripes":    func(size float64) bool { return int(size*3)%2 == 0 },
+		"nothing":    func(size float64) bool { return false },
+		"everything": func(size float64) bool { return true },
+	}
+	for name, fits := range rules {
+		want, wantErr := sequentialFontSize(fits)
+
+		// one size at a time is the same search as before
+		p, _, err := searchFontSize(1, tryRule(fits))
+		if (err != nil) != (wantErr != nil) {
+			t.Errorf("%s: error %v, expected %v", name, err, wantErr)
+			continue
+		}
+		if err == nil && p.fontSize != want {
+			t.Errorf("%s: found %.4f, expected %.4f", name, p.fontSize, want)
+		}
+
+		// with more sizes at once, the answer always fits and the
+		// next size up does not, even when fitting is not monotonic
+		for width := 2; width <= 8; width++ {
+			var tried []*probe
+			p, _, err := searchFontSize(width, func(sizes []float64) []*probe {
+				results := tryRule(fits)(sizes)
+				tried = append(tried, results...)
+				return results
+			})
+			if (err != nil) != (wantErr != nil) {
+				t.Errorf("%s, %d at a time: error %v, expected %v", name, width, err, wantErr)
+				continue
+			}
+			if err != nil {
+				continue
+			}
+			if !fits(p.fontSize) {
+				t.Errorf("%s, %d at a time: %.4f does not fit", name, width, p.fontSize)
+			}
+			bracketed := false
+			for _, elt := range tried {
+				if !elt.fits && elt.fontSize > p.fontSize && elt.fontSize-p.fontSize < FontSizePrecision {
+					bracketed = true
+				}
+			}
+			if !bracketed {
+				t.Errorf("%s, %d at a time: nothing just above %.4f was found not to fit", name, width, p.fontSize)
+			}
+			if name == "start" || name == "small" || name == "large" {
+				if math.Abs(p.fontSize-want) >= FontSizePrecision {
+					t.Errorf("%s, %d at a time: found %.4f, expected about %.4f", name, width, p.fontSize, want)
+				}
+			}
+		}
+	}
+}
+
+// entries that fit on one line are not broken again, but the breaks
+// must be the same as if they were
+func TestOneLineWidths(t *testing.T) {
+	l := randomLayout(rand.New(rand.NewSource(3)), 200)
+	oneline := l.oneLineWidths()
+	for _, size := range []float64{2, 3.5, 5, 7.25, 10, 14} {
+		with, without := l.probe(size, oneline), l.probe(size, nil)
+		for i := range l.Entries {
+			if !sameBreaks(with.linebreaks[i], without.linebreaks[i]) {
+				t.Errorf("size %g, entry %d: line breaks %v, expected %v", size, i, with.linebreaks[i], without.linebreaks[i])
+			}
+		}
+		if !sameBreaks(with.columnbreaks, without.columnbreaks) {
+			t.Errorf("size %g: column breaks differ", size)
+		}
+	}
+}
+
+func TestFindFontSizeMatchesSequential(t *testing.T) {
+	for seed := int64(1); seed <= 3; seed++ {
+		l := randomLayout(rand.New(rand.NewSource(seed)), 150*int(seed))
+		want, err := sequentialFontSize(func(size float64) bool {
+			l.FontSize = size
+			return l.DoLayout()
+		})
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+
+		for _, width := range []int{1, 4} {
+			old := runtime.GOMAXPROCS(width)
+			_, err := l.FindFontSize()
+			runtime.GOMAXPROCS(old)
+			if err != nil {
+				t.Errorf("seed %d, %d at a time: %v", seed, width, err)
+				continue
+			}
+			if width == 1 && l.FontSize != want || math.Abs(l.FontSize-want) >= FontSizePrecision {
+				t.Errorf("seed %d, %d at a time: found %.4f, expected %.4f", seed, width, l.FontSize, want)
+			}
+
+			// the breaks kept are the ones for the size chosen
+			lines, columns := l.Linebreaks, l.Columnbreaks
+			if !l.DoLayout() || !sameBreaks(columns, l.Columnbreaks) || len(lines) != len(l.Linebreaks) {
+				t.Errorf("seed %d, %d at a time: the breaks kept are not for %.4f", seed, width, l.FontSize)
+			}
+		}
+	}
+}
@@ -0,0 +1,225 @@
+//
+// Commands
+// The web interface is the default; the generate command makes a
+// directory without a browser, so it can be scripted, and the batch
+// command makes one for each ward in a manifest
+//
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/russross/warddirectory/membership"
+)
+
+// a flag that can be given more than once
+type fileList []string
+
+func (list *fileList) String() string {
+	return strings.Join(*list, ", ")
+}
+
+func (list *fileList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage:\n")
+	fmt.Fprintf(os.Stderr, "  %s [serve] [-addr address]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "        run the web interface (the default)\n")
+	fmt.Fprintf(os.Stderr, "  %s generate [-config settings.json] -in membership [-in membership...] [-out directory.pdf]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "        make a directory without a browser\n")
+	fmt.Fprintf(os.Stderr, "  %s batch -manifest wards.json [-out folder] [-zip directories.zip]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "        make a directory for each ward in a manifest\n")
+	fmt.Fprintf(os.Stderr, "Use \"%s <command> -h\" for the options of each command\n", os.Args[0])
+}
+
+func main() {
+	gen, err := NewGenerator()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// with no command, act like the web app always has
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "serve":
+		serveCommand(args, gen)
+	case "generate":
+		generateCommand(args, gen)
+	case "batch":
+		batchCommand(args, gen)
+	case "help":
+		usage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n", command)
+		usage()
+		os.Exit(2)
+	}
+}
+
+func serveCommand(args []string, gen *Generator) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", "127.0.0.1:1830", "the address to listen on")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	serve(*addr, gen)
+}
+
+// make a directory using the same steps as the Generate button
+// the saved overrides are applied and the edition is saved, just as
+// they are for the web interface
+func generateCommand(args []string, gen *Generator) {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	configPath := flags.String("config", "", "settings file from “Export settings” (default: the settings saved by the web interface)")
+	var inputs fileList
+	flags.Var(&inputs, "in", "membership data file; give it more than once to combine several files")
+	baselinePath := flags.String("baseline", "", "file to compare against when marking new households (default: the last edition)")
+	out := flags.String("out", "directory.pdf", "where to write the PDF file")
+	flags.Parse(args)
+	if flags.NArg() > 0 || len(inputs) == 0 {
+		fmt.Fprintf(os.Stderr, "generate: at least one -in file is needed\n")
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	// load the settings
+	var config *Directory
+	var err error
+	if *configPath == "" {
+		config, err = gen.SavedSettings()
+	} else {
+		config, err = gen.ReadSettings(*configPath)
+	}
+	if err != nil {
+		log.Fatalf("Loading the settings: %v", err)
+	}
+
+	// load the membership data
+	var files []*MembershipFile
+	for _, name := range inputs {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			log.Fatalf("Reading membership data: %v", err)
+		}
+		files = append(files, &MembershipFile{Name: name, Data: data})
+	}
+	if err = config.ReadMembership(files); err != nil {
+		log.Fatalf("Reading membership data: %v", err)
+	}
+	config.LoadPreviousEdition()
+	if err = config.ApplySavedOverrides(); err != nil {
+		log.Fatalf("Applying overrides: %v", err)
+	}
+
+	var baseline []*membership.Family
+	if *baselinePath != "" {
+		data, err := ioutil.ReadFile(*baselinePath)
+		if err != nil {
+			log.Fatalf("Reading the baseline: %v", err)
+		}
+		if baseline, err = config.ReadBaseline(&MembershipFile{Name: *baselinePath, Data: data}); err != nil {
+			log.Fatalf("Reading the baseline: %v", err)
+		}
+	}
+
+	result, err := config.Generate(baseline, *baselinePath)
+	if err != nil {
+		log.Fatalf("Generating the directory: %v", err)
+	}
+	if err = ioutil.WriteFile(*out, result.PDF, 0644); err != nil {
+		log.Fatalf("Writing the directory: %v", err)
+	}
+
+	// a short summary; the warnings were logged as they were found
+	report := config.Report
+	fmt.Printf("Wrote %s: %d families, font size %.2f\n", *out, report.Families, config.FontSize)
+	if len(report.Warnings) > 0 {
+		fmt.Printf("%d warnings; see the messages above\n", len(report.Warnings))
+	}
+	if changes := result.Changes; changes != nil {
+		fmt.Printf("Since %s: %d moved in, %d moved out, %d moved, %d other changes\n",
+			changes.Since.Format("January 2, 2006"),
+			len(changes.Added), len(changes.Removed), len(changes.Moved), len(changes.Changed))
+	}
+	if result.Marked > 0 {
+		fmt.Printf("Marked %d new households\n", result.Marked)
+	}
+}
+
+// make a directory for each ward in a manifest, several at a time
+func batchCommand(args []string, gen *Generator) {
+	flags := flag.NewFlagSet("batch", flag.ExitOnError)
+	manifestPath := flags.String("manifest", "", "file listing each ward's settings and membership files")
+	out := flags.String("out", ".", "folder to write each ward's PDF file to")
+	zipPath := flags.String("zip", "", "also write all of the PDF files to this zip file")
+	parallel := flags.Int("parallel", runtime.NumCPU(), "how many wards to generate at once")
+	flags.Parse(args)
+	if flags.NArg() > 0 || *manifestPath == "" {
+		fmt.Fprintf(os.Stderr, "batch: a -manifest file is needed\n")
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	manifest, err := ReadManifest(*manifestPath)
+	if err != nil {
+		log.Fatalf("Reading the manifest: %v", err)
+	}
+	if err = os.MkdirAll(*out, 0755); err != nil {
+		log.Fatalf("Making the output folder: %v", err)
+	}
+
+	results := manifest.Generate(gen, *parallel)
+
+	failed := 0
+	for _, result := range results {
+		if result.Err == nil {
+			name := filepath.Join(*out, result.Filename)
+			if result.Err = ioutil.WriteFile(name, result.PDF, 0644); result.Err == nil {
+				fmt.Printf("%s: wrote %s: %d families, font size %.2f\n",
+					result.Ward.Name, name, result.Directory.Report.Families, result.Directory.FontSize)
+				if n := len(result.Directory.Report.Warnings); n > 0 {
+					fmt.Printf("%s: %d warnings; see the messages above\n", result.Ward.Name, n)
+				}
+				if result.Marked > 0 {
+					fmt.Printf("%s: marked %d new households\n", result.Ward.Name, result.Marked)
+				}
+				continue
+			}
+		}
+		fmt.Printf("%s: failed: %v\n", result.Ward.Name, result.Err)
+		failed++
+	}
+
+	if *zipPath != "" {
+		data, err := ZipDirectories(results)
+		if err == nil {
+			err = ioutil.WriteFile(*zipPath, data, 0644)
+		}
+		if err != nil {
+			log.Fatalf("Writing the zip file: %v", err)
+		}
+		fmt.Printf("Wrote %s with %d directories\n", *zipPath, len(results)-failed)
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d of %d wards failed\n", failed, len(results))
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,266 @@
+//
+// Spreadsheet import
+// Code to load households from a CSV or TSV file instead of
+// the printed directory PDF
+//
+
+package membership
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// which spreadsheet columns hold which details
+// each field is a comma-separated list of header names (case does not matter)
+// every matching address column becomes one line of the address
+type ColumnMapping struct {
+	Household   string
+	Surname     string
+	Head        string
+	HeadPhone   string
+	HeadEmail   string
+	Spouse      string
+	SpousePhone string
+	SpouseEmail string
+	Children    string
+	Phone       string
+	Email       string
+	Address     string
+}
+
+// the column numbers found for each field of a mapping
+type columnIndex struct {
+	household, surname, children     []int
+	head, headPhone, headEmail       []int
+	spouse, spousePhone, spouseEmail []int
+	phone, email, address            []int
+}
+
+func findColumns(header []string, names string) (cols []int) {
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		for i, elt := range header {
+			if strings.ToLower(strings.TrimSpace(elt)) == name {
+				cols = append(cols, i)
+			}
+		}
+	}
+	return cols
+}
+
+func (mapping *ColumnMapping) index(header []string) *columnIndex {
+	return &columnIndex{
+		household:   findColumns(header, mapping.Household),
+		surname:     findColumns(header, mapping.Surname),
+		head:        findColumns(header, mapping.Head),
+		headPhone:   findColumns(header, mapping.HeadPhone),
+		headEmail:   findColumns(header, mapping.HeadEmail),
+		spouse:      findColumns(header, mapping.Spouse),
+		spousePhone: findColumns(header, mapping.SpousePhone),
+		spouseEmail: findColumns(header, mapping.SpouseEmail),
+		children:    findColumns(header, mapping.Children),
+		phone:       findColumns(header, mapping.Phone),
+		email:       findColumns(header, mapping.Email),
+		address:     findColumns(header, mapping.Address),
+	}
+}
+
+// the first non-blank value from a set of columns
+func cell(record []string, cols []int) string {
+	for _, col := range cols {
+		if col < len(record) {
+			if s := strings.TrimSpace(Spaces.ReplaceAllString(record[col], " ")); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// all non-blank values from a set of columns
+func cells(record []string, cols []int) (out []string) {
+	for _, col := range cols {
+		if col < len(record) {
+			if s := strings.TrimSpace(Spaces.ReplaceAllString(record[col], " ")); s != "" {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+// put a name in "Surname, Given" form to match the printed directory
+func fullName(surname, name string) string {
+	if name == "" || strings.Contains(name, ",") || surname == "" {
+		return name
+	}
+	return surname + ", " + name
+}
+
+// split a list of children's names
+func splitNames(s string) (out []string) {
+	for _, elt := range strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == '\n' || r == '|' }) {
+		if elt = strings.TrimSpace(elt); elt != "" {
+			out = append(out, elt)
+		}
+	}
+	return out
+}
+
+// build families from spreadsheet rows; the first row is the header
+// rows with the same household key are merged into a single family
+func familiesFromRecords(records [][]string, mapping *ColumnMapping) ([]*Family, *ParseReport, error) {
+	report := new(ParseReport)
+	if len(records) < 2 {
+		return nil, report, errors.New("No rows found in the membership data")
+	}
+	cols := mapping.index(records[0])
+	if len(cols.head) == 0 && len(cols.surname) == 0 {
+		return nil, report, errors.New("The membership data has no surname or head of household column; check the spreadsheet column settings")
+	}
+
+	var families []*Family
+	households := make(map[string]*Family)
+	for n, record := range records[1:] {
+		row := n + 2
+
+		// find the surname, taking it from the head of household if necessary
+		surname := cell(record, cols.surname)
+		head := cell(record, cols.head)
+		if surname == "" {
+			if comma := strings.Index(head, ","); comma > 0 {
+				surname = strings.TrimSpace(head[:comma])
+			}
+		}
+		if surname == "" {
+			if strings.TrimSpace(strings.Join(record, "")) != "" {
+				report.Unclassified++
+				report.Warn(fmt.Sprintf("row %d", row), nil, strings.Join(record, " | "), "no surname found in row")
+			}
+			continue
+		}
+		address := cells(record, cols.address)
+
+		// find the household
+		key := strings.ToLower(cell(record, cols.household))
+		if key == "" {
+			key = strings.ToLower(surname + "\n" + strings.Join(address, "\n"))
+			if len(address) == 0 {
+				key += "\n" + strings.ToLower(head)
+			}
+		}
+		family := households[key]
+		if family == nil {
+			family = &Family{Surname: surname, Address: address}
+			households[key] = family
+			families = append(families, family)
+			report.Families++
+		}
+		if family.Phone == "" {
+			family.Phone = cell(record, cols.phone)
+		}
+		if family.Email == "" {
+			family.Email = cell(record, cols.email)
+		}
+		if len(family.Address) == 0 {
+			family.Address = address
+		}
+
+		// adults
+		adults := []struct {
+			name, phone, email []int
+		}{
+			{cols.head, cols.headPhone, cols.headEmail},
+			{cols.spouse, cols.spousePhone, cols.spouseEmail},
+		}
+		for _, adult := range adults {
+			name := fullName(surname, cell(record, adult.name))
+			if name == "" || hasPerson(family, name) {
+				continue
+			}
+			family.People = append(family.People, &Person{
+				Name:  name,
+				Phone: cell(record, adult.phone),
+				Email: cell(record, adult.email),
+			})
+			if len(family.People) == 1 {
+				family.Couple = name
+			} else {
+				family.HasCouple = true
+				family.Couple += " & " + name
+			}
+			report.Adults++
+		}
+
+		// children
+		for _, s := range cells(record, cols.children) {
+			for _, name := range splitNames(s) {
+				name = fullName(surname, name)
+				if hasPerson(family, name) {
+					continue
+				}
+				family.People = append(family.People, &Person{Name: name})
+				report.Children++
+			}
+		}
+
+		if len(family.People) == 0 {
+			report.Warn(fmt.Sprintf("row %d", row), family, strings.Join(record, " | "), "no names found in row")
+		}
+	}
+
+	if len(families) == 0 {
+		return nil, report, errors.New("No families found in the membership data")
+	}
+	return families, report, nil
+}
+
+func hasPerson(family *Family, name string) bool {
+	for _, elt := range family.People {
+		if strings.EqualFold(elt.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// load families from a CSV or TSV file using the configured column mapping
+func (opts *Options) ParseCSV(data []byte) ([]*Family, *ParseReport, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	// guess the separator from the header line
+	reader := csv.NewReader(bytes.NewReader(data))
+	if looksTabSeparated(data) {
+		reader.Comma = '\t'
+	}
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		log.Printf("Error parsing spreadsheet: %v", err)
+		return nil, new(ParseReport), err
+	}
+
+	return familiesFromRecords(records, &opts.ColumnMapping)
+}
+
+func firstLine(data []byte) []byte {
+	if newline := bytes.IndexByte(data, '\n'); newline >= 0 {
+		return data[:newline]
+	}
+	return data
+}
+
+func looksTabSeparated(data []byte) bool {
+	line := firstLine(data)
+	return bytes.Count(line, []byte("\t")) > bytes.Count(line, []byte(","))
+}
@@ -0,0 +1,118 @@
+package membership
+
+import (
+	"testing"
+)
+
+func TestParseCSVHouseholds(t *testing.T) {
+	data := "Household,Surname,Head,Spouse,Children,Phone,Address,City\n" +
+		// one household spread over two rows
+		"17,Smith,John,Jane,,801-555-1234,123 Main St,Provo\n" +
+		"17,Smith,,,Tom; Ann,,,\n" +
+		// no household key: the surname and address decide
+		",Jones,Bob,,,,9 Elm St,Orem\n" +
+		",Jones,,Sue,Zed,,9 Elm St,Orem\n" +
+		// the same surname at a different address is a different family
+		",Jones,Ed,,,,1 Oak Ave,Orem\n" +
+		// the surname comes from the head of household
+		",,\"Brown, Alice\",,,,,\n"
+
+	opts := &Options{ColumnMapping: testMapping}
+	families, report, err := opts.ParseCSV([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		surname, couple string
+		people          int
+	}{
+		{"Smith", "Smith, John & Smith, Jane", 4},
+		{"Jones", "Jones, Bob & Jones, Sue", 3},
+		{"Jones", "Jones, Ed", 1},
+		{"Brown", "Brown, Alice", 1},
+	}
+	if len(families) != len(expected) {
+		t.Fatalf("found %d families, expected %d", len(families), len(expected))
+	}
+	for i, elt := range expected {
+		family := families[i]
+		if family.Surname != elt.surname || family.Couple != elt.couple || len(family.People) != elt.people {
+			t.Errorf("family %d is %s (%s) with %d people, expected %s (%s) with %d",
+				i, family.Surname, family.Couple, len(family.People), elt.surname, elt.couple, elt.people)
+		}
+	}
+	smith := families[0]
+	if smith.Phone != "801-555-1234" || len(smith.Address) != 2 || smith.Address[1] != "Provo" {
+		t.Errorf("Smith family phone %q and address %q", smith.Phone, smith.Address)
+	}
+	if names := smith.People[2].Name + "|" + smith.People[3].Name; names != "Smith, Tom|Smith, Ann" {
+		t.Errorf("Smith children are %s", names)
+	}
+	if report.Families != 4 || report.Adults != 6 || report.Children != 3 || len(report.Warnings) != 0 {
+		t.Errorf("report is %+v", report)
+	}
+}
+
+func TestParseCSVNoSurname(t *testing.T) {
+	data := "Surname,Head,Phone\n" +
+		"Smith,John,801-555-1234\n" +
+		",John,801-555-9999\n" +
+		",,\n"
+
+	opts := &Options{ColumnMapping: testMapping}
+	families, report, err := opts.ParseCSV([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 1 || report.Unclassified != 1 {
+		t.Fatalf("found %d families and %d unclassified rows, expected 1 and 1", len(families), report.Unclassified)
+	}
+	if len(report.Warnings) != 1 {
+		t.Fatalf("found %d warnings, expected 1", len(report.Warnings))
+	}
+	warning := report.Warnings[0]
+	if warning.Where != "row 3" || warning.Message != "no surname found in row" {
+		t.Errorf("warning is %+v", warning)
+	}
+}
+
+func TestParseCSVSeparators(t *testing.T) {
+	tests := []struct {
+		name, data string
+	}{
+		{"comma", "Surname,Head\nSmith,\"John, Jr.\"\n"},
+		{"tab", "Surname\tHead\nSmith\tJohn, Jr.\n"},
+		{"byte order mark", "\xef\xbb\xbfSurname,Spouse\nSmith,Jane\n"},
+		{"byte order mark and tab", "\xef\xbb\xbfSurname\tSpouse\r\nSmith\tJane\r\n"},
+	}
+	opts := &Options{ColumnMapping: testMapping}
+	for _, test := range tests {
+		families, _, err := opts.ParseCSV([]byte(test.data))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if len(families) != 1 || families[0].Surname != "Smith" || len(families[0].People) != 1 {
+			t.Errorf("%s: found %d families", test.name, len(families))
+		}
+	}
+}
+
+func TestLooksTabSeparated(t *testing.T) {
+	tests := []struct {
+		line string
+		tabs bool
+	}{
+		{"Surname,Head,Phone", false},
+		{"Surname\tHead\tPhone", true},
+		{"Surname\tHead, Spouse\tPhone\nSmith,John,,,,,", true},
+		{"Surname,Head\tSpouse,Phone", false},
+		{"Surname", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if got := looksTabSeparated([]byte(test.line)); got != test.tabs {
+			t.Errorf("looksTabSeparated(%q) is %v, expected %v", test.line, got, test.tabs)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+//
+// Printed directory import
+// Code to extract the families from the text of a printed
+// directory PDF
+//
+
+package membership
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/russross/warddirectory/pdf"
+)
+
+// extract families from a printed directory PDF
+func (opts *Options) ParseFamilies(data []byte) (families []*Family, report *ParseReport, err error) {
+	var family *Family
+	var person *Person
+	report = new(ParseReport)
+
+	// load the PDF file
+	doc, err := pdf.NewReader(data)
+	if err != nil {
+		log.Printf("Error opening PDF file: %v", err)
+		return nil, report, err
+	}
+	pages, err := doc.Pages()
+	if err != nil {
+		log.Printf("Error finding pages in PDF file: %v", err)
+		return nil, report, err
+	}
+
+	// gather all of the text and photos, in order
+	var runs []*pdf.TextRun
+	var images []*imageRun
+	for _, page := range pages {
+		contents, err := doc.PageContents(page)
+		if err != nil {
+			log.Printf("Error reading contents of page %d: %v", page.Number, err)
+			return nil, report, err
+		}
+		scanner := &pageScanner{doc: doc, page: page.Number}
+		if err = scanner.scan(contents, page.Resources, pdf.Identity, 0); err != nil {
+			log.Printf("Error interpreting contents of page %d: %v", page.Number, err)
+			return nil, report, err
+		}
+		runs = append(runs, scanner.runs...)
+		images = append(images, scanner.images...)
+	}
+
+	if len(runs) == 0 {
+		return nil, report, errors.New("No text found in the membership data")
+	}
+
+	// decide what each style of text means
+	profile, err := opts.ChooseProfile(runs)
+	if err != nil {
+		log.Printf("Error choosing an extraction profile: %v", err)
+		return nil, report, err
+	}
+
+	// use a state machine to extract families
+	var surnames []surnameRun
+	for _, run := range runs {
+		role := profile.Role(run)
+		text := strings.TrimSpace(Spaces.ReplaceAllString(run.Text, " "))
+		if text == "" {
+			continue
+		}
+
+		// skip letter headers: assume no families have single letter last name
+		if len(text) == 1 && role == RoleSurname {
+			continue
+		}
+
+		// skip headers and footers
+		if role == RoleHeader || role == RoleFooter {
+			continue
+		}
+
+		// new family?
+		if role == RoleSurname {
+			// create a new record
+			family = new(Family)
+			families = append(families, family)
+
+			family.Surname = text
+			report.Families++
+			surnames = append(surnames, surnameRun{run: run, family: family})
+			continue
+		}
+
+		// everything else belongs to a family
+		if family == nil {
+			report.Unclassified++
+			report.Warn(fmt.Sprintf("page %d", run.Page), nil, text, "text before the first family")
+			continue
+		}
+
+		// new adult?
+		if role == RoleAdult {
+			// create a new person
+			person = new(Person)
+			family.People = append(family.People, person)
+
+			if len(family.People) == 1 {
+				family.Couple = text
+			}
+			if len(family.People) > 1 {
+				family.HasCouple = true
+				family.Couple += " & " + text
+			}
+			person.Name = text
+			report.Adults++
+			continue
+		}
+
+		// new child?
+		if role == RoleChild {
+			// create a new person
+			person = new(Person)
+			family.People = append(family.People, person)
+
+			person.Name = text
+			report.Children++
+			continue
+		}
+
+		// contact details for family?
+		if role == RoleContact && len(family.People) == 0 {
+			if looksLikeEmail(text) {
+				// looks like an email address
+				family.Email = text
+			} else if looksLikePhone(text) {
+				family.Phone = text
+			} else {
+				family.Address = append(family.Address, text)
+			}
+			continue
+		}
+
+		// contact details for individual?
+		if role == RoleContact {
+			if looksLikeEmail(text) {
+				// looks like an email address
+				person.Email = text
+			} else if looksLikePhone(text) {
+				person.Phone = text
+			} else {
+				report.Unclassified++
+				report.Warn(fmt.Sprintf("page %d", run.Page), family, text, "contact for person not recognized")
+			}
+			continue
+		}
+
+		report.Unclassified++
+		report.Warn(fmt.Sprintf("page %d", run.Page), family, text, "unknown text")
+	}
+
+	// match the photos to the families
+	attachPhotos(images, surnames, report)
+
+	if len(families) == 0 {
+		return nil, report, errors.New("No families found in the membership data")
+	}
+	return families, report, nil
+}
+
+func looksLikeEmail(s string) bool {
+	return strings.Contains(s, "@")
+}
+
+func looksLikePhone(s string) bool {
+	return Phone7Digit.MatchString(s) || Phone10Digit.MatchString(s)
+}
+
+// phone numbers with and without an area code, and runs of spaces
+var Phone10Digit = regexp.MustCompile(`^\D*(\d{3})[^a-zA-Z0-9]*(\d{3})[^a-zA-Z0-9]*(\d{4})\D*$`)
+var Phone7Digit = regexp.MustCompile(`^\D*(\d{3})[^a-zA-Z0-9]*(\d{4})\D*$`)
+var Spaces = regexp.MustCompile(`\s+`)
@@ -0,0 +1,51 @@
+//
+// Households
+// The families and people read from the membership data
+//
+
+// Package membership reads ward membership data from printed
+// directory PDFs, spreadsheets, vCards, and household files, and
+// merges the families found in several files into one list.
+package membership
+
+// one member of a household
+type Person struct {
+	Name  string
+	Phone string
+	Email string
+}
+
+// a household: the adults named in Couple come first in People
+type Family struct {
+	Surname   string
+	Couple    string
+	HasCouple bool `json:"-"`
+	New       bool `json:"-"`
+	Address   []string
+	Phone     string
+	Email     string
+	People    []*Person
+	Photo     []byte `json:",omitempty"`
+}
+
+// a copy of the family that can be changed without touching the original
+// the photo is shared, since it is never changed in place
+func (family *Family) Copy() *Family {
+	elt := new(Family)
+	*elt = *family
+	elt.Address = append([]string(nil), family.Address...)
+	elt.People = nil
+	for _, person := range family.People {
+		p := *person
+		elt.People = append(elt.People, &p)
+	}
+	return elt
+}
+
+// copy a list of families
+func CopyFamilies(families []*Family) (lst []*Family) {
+	for _, family := range families {
+		lst = append(lst, family.Copy())
+	}
+	return lst
+}
@@ -0,0 +1,110 @@
+//
+// Household files
+// A JSON format for the list of families, so it can be edited by hand,
+// kept under version control, and used in place of the PDF
+//
+
+package membership
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// the format name and current version of household files
+// readers accept any version up to the current one
+const (
+	HouseholdFormat  = "warddirectory-households"
+	HouseholdVersion = 1
+)
+
+// a household file (see README.md for an example)
+// the adults are the people named in Couple, in the same order
+// and listed first; everyone else is a child
+type HouseholdFile struct {
+	Format   string
+	Version  int
+	Families []*Family
+}
+
+// encode a list of families as a household file
+func EncodeHouseholds(families []*Family) ([]byte, error) {
+	file := &HouseholdFile{
+		Format:   HouseholdFormat,
+		Version:  HouseholdVersion,
+		Families: families,
+	}
+
+	// leave ampersands alone so the file is easy to edit
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(file); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// load families from a household file
+func ParseHouseholds(data []byte) (families []*Family, report *ParseReport, err error) {
+	report = new(ParseReport)
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	var file HouseholdFile
+	if err = json.Unmarshal(data, &file); err != nil {
+		log.Printf("Error parsing household file: %v", err)
+		return nil, report, fmt.Errorf("Unable to parse household file: %v", err)
+	}
+	if file.Format != HouseholdFormat {
+		return nil, report, fmt.Errorf("Not a household file: format is %q instead of %q", file.Format, HouseholdFormat)
+	}
+	if file.Version < 1 || file.Version > HouseholdVersion {
+		return nil, report, fmt.Errorf("Unsupported household file version %d; this version of the app reads up to version %d", file.Version, HouseholdVersion)
+	}
+
+	for i, family := range file.Families {
+		where := fmt.Sprintf("family %d", i+1)
+		if family == nil || strings.TrimSpace(family.Surname) == "" {
+			report.Unclassified++
+			report.Warn(where, nil, "", "family has no surname")
+			continue
+		}
+
+		// drop empty entries
+		var people []*Person
+		for _, person := range family.People {
+			if person != nil && strings.TrimSpace(person.Name) != "" {
+				people = append(people, person)
+			} else {
+				report.Unclassified++
+				report.Warn(where, family, "", "person has no name")
+			}
+		}
+		family.People = people
+
+		// the couple decides who is an adult
+		adults := 0
+		if family.Couple != "" {
+			adults = len(strings.Split(family.Couple, " & "))
+		}
+		if adults > len(family.People) {
+			adults = len(family.People)
+		}
+		family.HasCouple = adults > 1
+
+		families = append(families, family)
+		report.Families++
+		report.Adults += adults
+		report.Children += len(family.People) - adults
+	}
+
+	if len(families) == 0 {
+		return nil, report, errors.New("No families found in the membership data")
+	}
+	return families, report, nil
+}
@@ -0,0 +1,143 @@
+//
+// Membership data importers
+// Code to recognize the format of uploaded membership data
+// and hand it to the right parser
+//
+
+package membership
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"unicode/utf8"
+)
+
+// the settings the importers use
+// Profiles are the extraction profiles for printed directories, and
+// ExtractionProfile names the one to use (or AutoDetectProfile to pick
+// the best match); ColumnMapping is used for spreadsheets
+type Options struct {
+	Profiles          []*ExtractionProfile
+	ExtractionProfile string
+	ColumnMapping     ColumnMapping
+}
+
+// a source of membership data
+type Importer interface {
+	// a short description of the format, for messages
+	Name() string
+
+	// does the data look like this format?
+	Sniff(data []byte) bool
+
+	// extract the families, reporting anything that was dropped
+	Import(opts *Options, data []byte) ([]*Family, *ParseReport, error)
+}
+
+// the known formats, checked in order
+// the spreadsheet importer accepts most text, so it comes last
+var Importers = []Importer{
+	pdfImporter{},
+	householdImporter{},
+	vcardImporter{},
+	xlsxImporter{},
+	csvImporter{},
+}
+
+// find the right importer for the data and use it
+func Import(opts *Options, data []byte) ([]*Family, *ParseReport, error) {
+	for _, importer := range Importers {
+		if importer.Sniff(data) {
+			log.Printf("Reading membership data as %s", importer.Name())
+			families, report, err := importer.Import(opts, data)
+			if report == nil {
+				report = new(ParseReport)
+			}
+			return families, report, err
+		}
+	}
+	return nil, new(ParseReport), errors.New("Unrecognized membership data format")
+}
+
+// skip a byte order mark and leading whitespace
+func trimLeading(data []byte) []byte {
+	return bytes.TrimLeft(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), "\x00\t\n\f\r ")
+}
+
+// printed directory PDF files
+type pdfImporter struct{}
+
+func (pdfImporter) Name() string {
+	return "a printed directory PDF"
+}
+
+func (pdfImporter) Sniff(data []byte) bool {
+	return bytes.HasPrefix(trimLeading(data), []byte("%PDF-"))
+}
+
+func (pdfImporter) Import(opts *Options, data []byte) ([]*Family, *ParseReport, error) {
+	return opts.ParseFamilies(data)
+}
+
+// JSON household files
+type householdImporter struct{}
+
+func (householdImporter) Name() string {
+	return "a household file"
+}
+
+func (householdImporter) Sniff(data []byte) bool {
+	return bytes.HasPrefix(trimLeading(data), []byte("{"))
+}
+
+func (householdImporter) Import(opts *Options, data []byte) ([]*Family, *ParseReport, error) {
+	return ParseHouseholds(data)
+}
+
+// vCard address books
+type vcardImporter struct{}
+
+func (vcardImporter) Name() string {
+	return "a vCard file"
+}
+
+func (vcardImporter) Sniff(data []byte) bool {
+	return bytes.HasPrefix(bytes.ToUpper(firstLine(trimLeading(data))), []byte("BEGIN:VCARD"))
+}
+
+func (vcardImporter) Import(opts *Options, data []byte) ([]*Family, *ParseReport, error) {
+	return ParseVCards(data)
+}
+
+// Excel spreadsheets: a zip archive with a workbook inside
+type xlsxImporter struct{}
+
+func (xlsxImporter) Name() string {
+	return "an Excel spreadsheet"
+}
+
+func (xlsxImporter) Sniff(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("PK\x03\x04")) && bytes.Contains(data, []byte("xl/"))
+}
+
+func (xlsxImporter) Import(opts *Options, data []byte) ([]*Family, *ParseReport, error) {
+	return opts.ParseXLSX(data)
+}
+
+// CSV and TSV spreadsheets
+type csvImporter struct{}
+
+func (csvImporter) Name() string {
+	return "a spreadsheet"
+}
+
+// text with a header line that has more than one column
+func (csvImporter) Sniff(data []byte) bool {
+	line := firstLine(trimLeading(data))
+	return utf8.Valid(line) && (bytes.IndexByte(line, ',') >= 0 || bytes.IndexByte(line, '\t') >= 0)
+}
+
+func (csvImporter) Import(opts *Options, data []byte) ([]*Family, *ParseReport, error) {
+	return opts.ParseCSV(data)
+}
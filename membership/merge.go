@@ -0,0 +1,269 @@
+//
+// Merging membership data
+// Code to combine families from several uploaded files into one list,
+// finding families that appear in more than one file and noting
+// where the files disagree
+//
+
+package membership
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// one uploaded membership file and what was found in it
+type Source struct {
+	Name     string
+	Families []*Family
+	Report   *ParseReport
+}
+
+// a value that differed between two files for the same family
+// the value from the earlier file is kept
+type MergeConflict struct {
+	Family        string
+	Field         string
+	Kept          string
+	KeptSource    string
+	Dropped       string
+	DroppedSource string
+}
+
+// a short description of a conflict, for logging
+func (conflict *MergeConflict) String() string {
+	return fmt.Sprintf("%s: %s is %q in %s but %q in %s; kept the first",
+		conflict.Family, conflict.Field,
+		conflict.Kept, conflict.KeptSource,
+		conflict.Dropped, conflict.DroppedSource)
+}
+
+// how many families each file contributed
+type SourceSummary struct {
+	Name       string
+	Families   int
+	Duplicates int
+}
+
+// reduce text to lower case words, ignoring punctuation
+func NormalizeWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// names match regardless of order: "Smith, John" and "John Smith"
+func NameKey(name string) string {
+	words := NormalizeWords(name)
+	sort.Strings(words)
+	return strings.Join(words, " ")
+}
+
+func coupleKey(couple string) string {
+	var names []string
+	for _, name := range strings.Split(couple, "&") {
+		if key := NameKey(name); key != "" {
+			names = append(names, key)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, " & ")
+}
+
+// common words in addresses and their usual abbreviations
+var addressAbbreviations = map[string]string{
+	"north":     "n",
+	"south":     "s",
+	"east":      "e",
+	"west":      "w",
+	"street":    "st",
+	"avenue":    "ave",
+	"road":      "rd",
+	"drive":     "dr",
+	"lane":      "ln",
+	"court":     "ct",
+	"circle":    "cir",
+	"place":     "pl",
+	"boulevard": "blvd",
+	"apartment": "apt",
+}
+
+// addresses match regardless of punctuation and common abbreviations
+func AddressKey(address []string) string {
+	words := NormalizeWords(strings.Join(address, " "))
+	for i, word := range words {
+		if abbrev, present := addressAbbreviations[word]; present {
+			words[i] = abbrev
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// the keys that identify a family across files:
+// surname and couple, and surname and address
+func FamilyKeys(family *Family) (keys []string) {
+	surname := strings.Join(NormalizeWords(family.Surname), " ")
+	if couple := coupleKey(family.Couple); couple != "" {
+		keys = append(keys, "couple\n"+surname+"\n"+couple)
+	}
+	if address := AddressKey(family.Address); address != "" {
+		keys = append(keys, "address\n"+surname+"\n"+address)
+	}
+	return keys
+}
+
+// the number of adults named in the couple
+func CoupleSize(family *Family) int {
+	if family.Couple == "" {
+		return 0
+	}
+	n := len(strings.Split(family.Couple, " & "))
+	if n > len(family.People) {
+		n = len(family.People)
+	}
+	return n
+}
+
+// combine the families from several files
+// files are listed in order of preference: when two files have
+// different values for the same family, the earlier one wins
+func MergeFamilies(sources []*Source) ([]*Family, *ParseReport) {
+	if len(sources) == 1 {
+		return sources[0].Families, sources[0].Report
+	}
+
+	report := new(ParseReport)
+	var families []*Family
+	owner := make(map[*Family]int)
+	known := make(map[string]*Family)
+
+	for n, source := range sources {
+		summary := &SourceSummary{Name: source.Name}
+		report.Sources = append(report.Sources, summary)
+
+		// keep the warnings, marked with the file they came from
+		if source.Report != nil {
+			report.Unclassified += source.Report.Unclassified
+			for _, warning := range source.Report.Warnings {
+				elt := *warning
+				elt.Where = source.Name + ", " + elt.Where
+				report.Warnings = append(report.Warnings, &elt)
+			}
+		}
+
+		for _, family := range source.Families {
+			summary.Families++
+			keys := FamilyKeys(family)
+
+			// look for the same family in an earlier file
+			var match *Family
+			for _, key := range keys {
+				if elt := known[key]; elt != nil && owner[elt] != n {
+					match = elt
+					break
+				}
+			}
+			if match == nil {
+				families = append(families, family)
+				owner[family] = n
+				for _, key := range keys {
+					if known[key] == nil {
+						known[key] = family
+					}
+				}
+				continue
+			}
+
+			summary.Duplicates++
+			report.Duplicates++
+			mergeFamily(report, match, sources[owner[match]].Name, family, source.Name)
+			for _, key := range keys {
+				if known[key] == nil {
+					known[key] = match
+				}
+			}
+		}
+	}
+
+	// count the merged list
+	for _, family := range families {
+		adults := CoupleSize(family)
+		report.Families++
+		report.Adults += adults
+		report.Children += len(family.People) - adults
+		if family.Photo != nil {
+			report.Photos++
+		}
+	}
+	return families, report
+}
+
+// fill in missing details of kept from dropped, noting any conflicts
+func mergeFamily(report *ParseReport, kept *Family, keptSource string, dropped *Family, droppedSource string) {
+	conflict := func(field, keptValue, droppedValue string) {
+		elt := &MergeConflict{
+			Family:        kept.Surname,
+			Field:         field,
+			Kept:          keptValue,
+			KeptSource:    keptSource,
+			Dropped:       droppedValue,
+			DroppedSource: droppedSource,
+		}
+		report.Conflicts = append(report.Conflicts, elt)
+		log.Printf("Merge conflict: %v", elt)
+	}
+	merge := func(field string, keptValue *string, droppedValue string) {
+		switch {
+		case droppedValue == "":
+		case *keptValue == "":
+			*keptValue = droppedValue
+		case strings.Join(NormalizeWords(*keptValue), " ") != strings.Join(NormalizeWords(droppedValue), " "):
+			conflict(field, *keptValue, droppedValue)
+		}
+	}
+
+	merge("phone", &kept.Phone, dropped.Phone)
+	merge("email", &kept.Email, dropped.Email)
+	switch {
+	case len(dropped.Address) == 0:
+	case len(kept.Address) == 0:
+		kept.Address = dropped.Address
+	case AddressKey(kept.Address) != AddressKey(dropped.Address):
+		conflict("address", strings.Join(kept.Address, ", "), strings.Join(dropped.Address, ", "))
+	}
+	if kept.Photo == nil {
+		kept.Photo = dropped.Photo
+	}
+
+	// match people by name, adding anyone who is missing
+	people := make(map[string]*Person)
+	for _, person := range kept.People {
+		people[NameKey(person.Name)] = person
+	}
+	droppedAdults := CoupleSize(dropped)
+	for i, person := range dropped.People {
+		if elt := people[NameKey(person.Name)]; elt != nil {
+			merge("phone for "+elt.Name, &elt.Phone, person.Phone)
+			merge("email for "+elt.Name, &elt.Email, person.Email)
+			continue
+		}
+		people[NameKey(person.Name)] = person
+		if i >= droppedAdults {
+			kept.People = append(kept.People, person)
+			continue
+		}
+
+		// adults go after the other adults and join the couple
+		adults := CoupleSize(kept)
+		kept.People = append(kept.People[:adults], append([]*Person{person}, kept.People[adults:]...)...)
+		if adults == 0 {
+			kept.Couple = person.Name
+		} else {
+			kept.HasCouple = true
+			kept.Couple += " & " + person.Name
+		}
+	}
+}
@@ -0,0 +1,164 @@
+//
+// Household photos
+// Code to find the photos drawn in a printed directory PDF,
+// and match each one to the family whose surname is printed next to it
+//
+
+package membership
+
+import (
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/russross/warddirectory/pdf"
+)
+
+// forms can draw other forms; give up below this depth
+const MaxFormDepth = 10
+
+// a JPEG image drawn on a page
+type imageRun struct {
+	Page   int
+	X      float64
+	Y      float64
+	Width  float64
+	Height float64
+	Data   []byte
+}
+
+// how far a point is from the image (zero if it is inside)
+func (img *imageRun) distance(x, y float64) float64 {
+	dx := math.Max(0, math.Max(img.X-x, x-(img.X+img.Width)))
+	dy := math.Max(0, math.Max(img.Y-y, y-(img.Y+img.Height)))
+	return math.Hypot(dx, dy)
+}
+
+// gathers the text and images from a page, including those drawn by forms
+type pageScanner struct {
+	doc    *pdf.Reader
+	page   int
+	runs   []*pdf.TextRun
+	images []*imageRun
+}
+
+func (ps *pageScanner) scan(contents []byte, resources pdf.Map, ctm pdf.Matrix, depth int) error {
+	interp := pdf.NewContentInterpreter(ps.page, ctm)
+	interp.Text = func(run *pdf.TextRun) {
+		ps.runs = append(ps.runs, run)
+	}
+	interp.XObject = func(name string, at pdf.Matrix) {
+		ps.xobject(resources, name, at, depth)
+	}
+	return interp.Run(contents)
+}
+
+// handle a Do operator
+// images and forms that cannot be read are skipped, since the text
+// matters more than the pictures
+func (ps *pageScanner) xobject(resources pdf.Map, name string, at pdf.Matrix, depth int) {
+	xobjects := ps.doc.LookupMap(resources["XObject"])
+	stream, isStream := ps.doc.Lookup(xobjects[name]).(*pdf.Stream)
+	if !isStream {
+		return
+	}
+
+	switch subtype, _ := ps.doc.Lookup(stream.Map["Subtype"]).(pdf.Name); subtype {
+	case "Image":
+		// only JPEG images can be used as they are
+		if !ps.isJPEG(stream) {
+			return
+		}
+		data, err := ps.doc.StreamData(stream)
+		if err != nil {
+			log.Printf("Error reading image %s on page %d: %v", name, ps.page, err)
+			return
+		}
+
+		// the image fills the unit square, so the matrix gives its corners
+		x0, y0 := at[4], at[5]
+		x1, y1 := at[0]+at[2]+at[4], at[1]+at[3]+at[5]
+		ps.images = append(ps.images, &imageRun{
+			Page:   ps.page,
+			X:      math.Min(x0, x1),
+			Y:      math.Min(y0, y1),
+			Width:  math.Abs(x1 - x0),
+			Height: math.Abs(y1 - y0),
+			Data:   data,
+		})
+
+	case "Form":
+		if depth >= MaxFormDepth {
+			log.Printf("Forms nested too deeply on page %d", ps.page)
+			return
+		}
+		data, err := ps.doc.StreamData(stream)
+		if err != nil {
+			log.Printf("Error reading form %s on page %d: %v", name, ps.page, err)
+			return
+		}
+		m := pdf.Identity
+		if elt, isSlice := ps.doc.Lookup(stream.Map["Matrix"]).(pdf.Slice); isSlice && len(elt) == 6 {
+			for i := range m {
+				n, _ := ps.doc.Lookup(elt[i]).(pdf.Number)
+				m[i] = float64(n)
+			}
+		}
+		formResources := ps.doc.LookupMap(stream.Map["Resources"])
+		if formResources == nil {
+			formResources = resources
+		}
+		if err = ps.scan(data, formResources, m.Multiply(at), depth+1); err != nil {
+			log.Printf("Error interpreting form %s on page %d: %v", name, ps.page, err)
+		}
+	}
+}
+
+// is the last filter on the image DCTDecode?
+func (ps *pageScanner) isJPEG(stream *pdf.Stream) bool {
+	var last pdf.Object
+	switch elt := ps.doc.Lookup(stream.Map["Filter"]).(type) {
+	case pdf.Name:
+		last = elt
+	case pdf.Slice:
+		if len(elt) > 0 {
+			last = elt[len(elt)-1]
+		}
+	}
+	name, _ := ps.doc.Lookup(last).(pdf.Name)
+	return name == "DCTDecode" || name == "DCT"
+}
+
+// a surname printed on a page and the family it starts
+type surnameRun struct {
+	run    *pdf.TextRun
+	family *Family
+}
+
+// give each photo to the family whose surname is printed closest to it
+// a surname must be within the photo's own size of it to count
+func attachPhotos(images []*imageRun, surnames []surnameRun, report *ParseReport) {
+	for _, img := range images {
+		var family *Family
+		limit := math.Max(img.Width, img.Height)
+		for _, elt := range surnames {
+			if elt.run.Page != img.Page {
+				continue
+			}
+			if d := img.distance(elt.run.X, elt.run.Y); d < limit || family == nil && d == limit {
+				family, limit = elt.family, d
+			}
+		}
+		where := fmt.Sprintf("page %d", img.Page)
+		if family == nil {
+			report.Warn(where, nil, "", "photo is not next to any surname")
+			continue
+		}
+		if family.Photo != nil {
+			report.Warn(where, family, "", "family has more than one photo; using the first")
+			continue
+		}
+		family.Photo = img.Data
+		report.Photos++
+	}
+}
@@ -0,0 +1,257 @@
+//
+// Extraction profiles
+// Code to decide what each string of text in a printed directory
+// means based on its font, size, and color
+//
+
+package membership
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+
+	"github.com/russross/warddirectory/pdf"
+)
+
+const (
+	RoleSurname = "surname"
+	RoleAdult   = "adult"
+	RoleChild   = "child"
+	RoleContact = "contact"
+	RoleHeader  = "header"
+	RoleFooter  = "footer"
+)
+
+const (
+	AutoDetectProfile   = "auto"
+	MinimumProfileScore = 0.9
+	SizeTolerance       = 0.05
+	ColorTolerance      = 0.01
+	ClusterSizeSpread   = 0.25
+)
+
+// text in a particular style and the role it plays
+// a blank font, zero size, or missing color matches anything
+type StyleRule struct {
+	Font  string
+	Size  float64
+	Color *pdf.RGB `json:",omitempty"`
+	Role  string
+}
+
+// a named set of rules describing one export format
+type ExtractionProfile struct {
+	Name  string
+	Rules []*StyleRule
+}
+
+func sameColor(a, b pdf.RGB) bool {
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > ColorTolerance {
+			return false
+		}
+	}
+	return true
+}
+
+func (rule *StyleRule) Matches(run *pdf.TextRun) bool {
+	if rule.Font != "" && rule.Font != run.Font {
+		return false
+	}
+	if rule.Size != 0 && math.Abs(rule.Size-run.Size) > SizeTolerance {
+		return false
+	}
+	if rule.Color != nil && !sameColor(*rule.Color, run.Color) {
+		return false
+	}
+	return true
+}
+
+// find the role of a string of text, or "" if no rule matches
+// the first matching rule wins
+func (profile *ExtractionProfile) Role(run *pdf.TextRun) string {
+	for _, rule := range profile.Rules {
+		if rule.Matches(run) {
+			return rule.Role
+		}
+	}
+	return ""
+}
+
+// what fraction of the text does this profile recognize?
+// profiles that find no families or no adults score zero
+func (profile *ExtractionProfile) Score(runs []*pdf.TextRun) float64 {
+	if len(runs) == 0 {
+		return 0
+	}
+	matched := 0
+	found := make(map[string]bool)
+	for _, run := range runs {
+		if role := profile.Role(run); role != "" {
+			matched++
+			found[role] = true
+		}
+	}
+	if !found[RoleSurname] || !found[RoleAdult] {
+		return 0
+	}
+	return float64(matched) / float64(len(runs))
+}
+
+// pick the profile to use for a set of text
+func (opts *Options) ChooseProfile(runs []*pdf.TextRun) (*ExtractionProfile, error) {
+	profiles := opts.Profiles
+
+	// did the user pick one?
+	if opts.ExtractionProfile != "" && opts.ExtractionProfile != AutoDetectProfile {
+		for _, elt := range profiles {
+			if elt.Name == opts.ExtractionProfile {
+				return elt, nil
+			}
+		}
+		return nil, fmt.Errorf("Unknown extraction profile: %q", opts.ExtractionProfile)
+	}
+
+	// find the best match
+	var best *ExtractionProfile
+	bestScore := 0.0
+	for _, elt := range profiles {
+		if score := elt.Score(runs); score > bestScore {
+			best, bestScore = elt, score
+		}
+	}
+	if best != nil && bestScore >= MinimumProfileScore {
+		log.Printf("Detected extraction profile %q (%.1f%% of text recognized)", best.Name, bestScore*100)
+		return best, nil
+	}
+
+	// fall back to guessing from the styles in use
+	guess := clusterProfile(runs)
+	if guess.Score(runs) <= bestScore {
+		if best == nil {
+			return nil, fmt.Errorf("Unable to recognize the format of the membership data")
+		}
+		log.Printf("Using closest extraction profile %q (%.1f%% of text recognized)", best.Name, bestScore*100)
+		return best, nil
+	}
+	log.Printf("No extraction profile matched, guessing from the text styles in use")
+	return guess, nil
+}
+
+// a group of text drawn in (nearly) the same style
+type styleCluster struct {
+	font  string
+	size  float64
+	color pdf.RGB
+	count int
+}
+
+// sortable list: largest first, darkest first within a size, then most common
+type clusterList []*styleCluster
+
+func (lst clusterList) Len() int {
+	return len(lst)
+}
+
+func (lst clusterList) Less(i, j int) bool {
+	a, b := lst[i], lst[j]
+	if math.Abs(a.size-b.size) > ClusterSizeSpread {
+		return a.size > b.size
+	}
+	if la, lb := luminance(a.color), luminance(b.color); la != lb {
+		return la < lb
+	}
+	return a.count > b.count
+}
+
+func (lst clusterList) Swap(i, j int) {
+	lst[i], lst[j] = lst[j], lst[i]
+}
+
+func luminance(c pdf.RGB) float64 {
+	return 0.299*c[0] + 0.587*c[1] + 0.114*c[2]
+}
+
+// build a profile by clustering the sizes and colors in use:
+// the largest and smallest sizes are headers and footers if there are
+// only a few of them on each page, the largest remaining size is the
+// surname, the next size down in the same font is for names (dark for
+// adults, lighter for children), and everything else is contact details
+func clusterProfile(runs []*pdf.TextRun) *ExtractionProfile {
+	var clusters []*styleCluster
+	pages := make(map[int]bool)
+	for _, run := range runs {
+		pages[run.Page] = true
+		var found *styleCluster
+		for _, elt := range clusters {
+			if elt.font == run.Font && math.Abs(elt.size-run.Size) <= ClusterSizeSpread && sameColor(elt.color, run.Color) {
+				found = elt
+				break
+			}
+		}
+		if found == nil {
+			found = &styleCluster{font: run.Font, size: run.Size, color: run.Color}
+			clusters = append(clusters, found)
+		}
+		found.count++
+	}
+
+	sort.Sort(clusterList(clusters))
+
+	profile := &ExtractionProfile{Name: "Detected from text styles"}
+	rule := func(elt *styleCluster, role string) {
+		color := elt.color
+		profile.Rules = append(profile.Rules, &StyleRule{
+			Font:  elt.font,
+			Size:  elt.size,
+			Color: &color,
+			Role:  role,
+		})
+	}
+
+	// headers and footers
+	furniture := 2 * len(pages)
+	for len(clusters) > 0 && clusters[0].count <= furniture {
+		rule(clusters[0], RoleHeader)
+		clusters = clusters[1:]
+	}
+	for len(clusters) > 0 && clusters[len(clusters)-1].count <= furniture {
+		rule(clusters[len(clusters)-1], RoleFooter)
+		clusters = clusters[:len(clusters)-1]
+	}
+	if len(clusters) == 0 {
+		return profile
+	}
+
+	// surnames
+	surname := clusters[0]
+	rule(surname, RoleSurname)
+	clusters = clusters[1:]
+
+	// adults: the largest, darkest smaller size in the surname font
+	var adult *styleCluster
+	for _, elt := range clusters {
+		if elt.font == surname.font && elt.size < surname.size-ClusterSizeSpread {
+			adult = elt
+			break
+		}
+	}
+	if adult == nil && len(clusters) > 0 {
+		adult = clusters[0]
+	}
+
+	for _, elt := range clusters {
+		switch {
+		case elt == adult:
+			rule(elt, RoleAdult)
+		case adult != nil && elt.font == adult.font && math.Abs(elt.size-adult.size) <= ClusterSizeSpread:
+			rule(elt, RoleChild)
+		default:
+			rule(elt, RoleContact)
+		}
+	}
+
+	return profile
+}
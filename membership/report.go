@@ -0,0 +1,63 @@
+//
+// Parse reports
+// Code to keep track of what happened to the membership data
+// so the clerk can see when something was dropped
+//
+
+package membership
+
+import (
+	"fmt"
+	"log"
+)
+
+// a problem found while reading the membership data
+type ParseWarning struct {
+	Where   string
+	Family  string
+	Text    string
+	Message string
+}
+
+// a summary of what was found in the membership data
+type ParseReport struct {
+	Families     int
+	Adults       int
+	Children     int
+	Unclassified int
+	Photos       int
+	Warnings     []*ParseWarning
+
+	// filled in when overrides are applied
+	Added  int
+	Hidden int
+	Edited int
+
+	// filled in when more than one file is merged
+	Sources    []*SourceSummary
+	Duplicates int
+	Conflicts  []*MergeConflict
+}
+
+// record a warning; it is also logged to the console
+// where is a page or row number in the original file
+func (report *ParseReport) Warn(where string, family *Family, text string, format string, args ...interface{}) {
+	elt := &ParseWarning{
+		Where:   where,
+		Text:    text,
+		Message: fmt.Sprintf(format, args...),
+	}
+	if family != nil {
+		elt.Family = family.Surname
+	}
+	report.Warnings = append(report.Warnings, elt)
+	log.Printf("Warning: %s: %s: [%s]", where, elt.Message, text)
+}
+
+// a copy of the report that can have more warnings added
+func (report *ParseReport) Copy() *ParseReport {
+	elt := new(ParseReport)
+	*elt = *report
+	elt.Warnings = append([]*ParseWarning(nil), report.Warnings...)
+	return elt
+}
@@ -0,0 +1,332 @@
+//
+// vCard import
+// Code to load households from an address book exported as
+// vCard 3.0 or 4.0 (.vcf) files
+//
+
+package membership
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// people younger than this (by BDAY) are listed as children
+const AdultAge = 18
+
+// one property of a card: NAME;PARAM=VALUE:value
+type vcardProperty struct {
+	name   string
+	params map[string][]string
+	value  string
+}
+
+// does the property have this TYPE (case does not matter)?
+func (prop *vcardProperty) hasType(kind string) bool {
+	for _, elt := range prop.params["TYPE"] {
+		for _, t := range strings.Split(elt, ",") {
+			if strings.EqualFold(strings.Trim(t, `"`), kind) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type vcard []*vcardProperty
+
+// the first property with the given name
+func (card vcard) get(name string) *vcardProperty {
+	for _, prop := range card {
+		if prop.name == name {
+			return prop
+		}
+	}
+	return nil
+}
+
+// the first property with the given name and type, or
+// the first with the given name if none has the type
+func (card vcard) getTyped(name, kind string) *vcardProperty {
+	for _, prop := range card {
+		if prop.name == name && prop.hasType(kind) {
+			return prop
+		}
+	}
+	return card.get(name)
+}
+
+// join folded lines: a line starting with a space or tab continues the last one
+func unfoldVCard(data []byte) []string {
+	data = bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// split a line into name, parameters, and value
+func parseVCardLine(line string) *vcardProperty {
+	colon := -1
+	quoted := false
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return nil
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	name := strings.ToUpper(strings.TrimSpace(parts[0]))
+
+	// drop any group prefix (item1.TEL)
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		name = name[dot+1:]
+	}
+
+	prop := &vcardProperty{
+		name:   name,
+		params: make(map[string][]string),
+		value:  line[colon+1:],
+	}
+	for _, param := range parts[1:] {
+		if eq := strings.Index(param, "="); eq >= 0 {
+			key := strings.ToUpper(param[:eq])
+			prop.params[key] = append(prop.params[key], param[eq+1:])
+		} else {
+			// vCard 2.1 style: TEL;HOME;VOICE
+			prop.params["TYPE"] = append(prop.params["TYPE"], param)
+		}
+	}
+	return prop
+}
+
+// split a structured value on unescaped semicolons and undo escapes
+func vcardFields(value string) []string {
+	var fields []string
+	var buf bytes.Buffer
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '\\' && i+1 < len(value):
+			i++
+			switch value[i] {
+			case 'n', 'N':
+				buf.WriteByte('\n')
+			default:
+				buf.WriteByte(value[i])
+			}
+		case c == ';':
+			fields = append(fields, strings.TrimSpace(buf.String()))
+			buf.Reset()
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return append(fields, strings.TrimSpace(buf.String()))
+}
+
+// the text of a simple value
+func vcardText(prop *vcardProperty) string {
+	if prop == nil {
+		return ""
+	}
+	s := strings.Join(vcardFields(prop.value), ";")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "tel:"), "mailto:")
+	return strings.TrimSpace(Spaces.ReplaceAllString(s, " "))
+}
+
+func vcardField(fields []string, n int) string {
+	if n < len(fields) {
+		return strings.TrimSpace(Spaces.ReplaceAllString(fields[n], " "))
+	}
+	return ""
+}
+
+// surname and given name from N, falling back to FN
+func vcardName(card vcard) (surname, given string) {
+	if prop := card.get("N"); prop != nil {
+		fields := vcardFields(prop.value)
+		surname, given = vcardField(fields, 0), vcardField(fields, 1)
+	}
+	if surname == "" && given == "" {
+		// assume FN is "Given Surname"
+		words := strings.Fields(vcardText(card.get("FN")))
+		if len(words) > 0 {
+			surname = words[len(words)-1]
+			given = strings.Join(words[:len(words)-1], " ")
+		}
+	}
+	return surname, given
+}
+
+// address lines from ADR: street lines, then "City, Region Code"
+func vcardAddress(prop *vcardProperty) (lines []string) {
+	if prop == nil {
+		return nil
+	}
+	fields := vcardFields(prop.value)
+	for _, street := range []string{vcardField(fields, 0), vcardField(fields, 1), vcardField(fields, 2)} {
+		for _, line := range strings.Split(street, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+	}
+	city, region, code := vcardField(fields, 3), vcardField(fields, 4), vcardField(fields, 5)
+	last := city
+	if region != "" {
+		if last != "" {
+			last += ", "
+		}
+		last += region
+	}
+	if code != "" {
+		last = strings.TrimSpace(last + " " + code)
+	}
+	if last != "" {
+		lines = append(lines, last)
+	}
+	return lines
+}
+
+// is this person a child, by X-HOUSEHOLD-ROLE or BDAY?
+func vcardIsChild(card vcard, now time.Time) bool {
+	if role := vcardText(card.get("X-HOUSEHOLD-ROLE")); role != "" {
+		return strings.EqualFold(role, "child")
+	}
+	bday := strings.Replace(vcardText(card.get("BDAY")), "-", "", -1)
+	if len(bday) < 8 {
+		return false
+	}
+	born, err := time.Parse("20060102", bday[:8])
+	if err != nil {
+		return false
+	}
+	return born.AddDate(AdultAge, 0, 0).After(now)
+}
+
+// split the file into cards
+func parseVCards(data []byte) (cards []vcard) {
+	var card vcard
+	inside := false
+	for _, line := range unfoldVCard(data) {
+		prop := parseVCardLine(line)
+		if prop == nil {
+			continue
+		}
+		switch {
+		case prop.name == "BEGIN" && strings.EqualFold(strings.TrimSpace(prop.value), "VCARD"):
+			card, inside = nil, true
+		case prop.name == "END" && strings.EqualFold(strings.TrimSpace(prop.value), "VCARD"):
+			if inside {
+				cards = append(cards, card)
+			}
+			inside = false
+		case inside:
+			card = append(card, prop)
+		}
+	}
+	return cards
+}
+
+// load families from a vCard file
+// cards are grouped into households by X-HOUSEHOLD, or else by address
+func ParseVCards(data []byte) (families []*Family, report *ParseReport, err error) {
+	report = new(ParseReport)
+	cards := parseVCards(data)
+	if len(cards) == 0 {
+		return nil, report, errors.New("No cards found in the vCard file")
+	}
+
+	now := time.Now()
+	households := make(map[string]*Family)
+	for i, card := range cards {
+		where := fmt.Sprintf("card %d", i+1)
+		surname, given := vcardName(card)
+		if surname == "" {
+			report.Unclassified++
+			report.Warn(where, nil, vcardText(card.get("FN")), "no name found on card")
+			continue
+		}
+		address := vcardAddress(card.getTyped("ADR", "home"))
+
+		// find the household by X-HOUSEHOLD or by address
+		var keys []string
+		if household := strings.ToLower(vcardText(card.get("X-HOUSEHOLD"))); household != "" {
+			keys = append(keys, "household\n"+household)
+		}
+		if len(address) > 0 {
+			keys = append(keys, "address\n"+strings.ToLower(strings.Join(address, "\n")))
+		}
+		var family *Family
+		for _, key := range keys {
+			if family = households[key]; family != nil {
+				break
+			}
+		}
+		if family == nil {
+			family = &Family{Surname: surname, Address: address}
+			families = append(families, family)
+			report.Families++
+		}
+		for _, key := range keys {
+			if households[key] == nil {
+				households[key] = family
+			}
+		}
+		if len(family.Address) == 0 {
+			family.Address = address
+		}
+
+		// a home phone number belongs to the household
+		person := &Person{Name: fullName(surname, given)}
+		for _, prop := range card {
+			switch {
+			case prop.name == "TEL" && prop.hasType("home") && family.Phone == "":
+				family.Phone = vcardText(prop)
+			case prop.name == "TEL" && !prop.hasType("home") && !prop.hasType("fax") && person.Phone == "":
+				person.Phone = vcardText(prop)
+			case prop.name == "EMAIL" && person.Email == "":
+				person.Email = vcardText(prop)
+			}
+		}
+
+		// adults go before children
+		if vcardIsChild(card, now) {
+			family.People = append(family.People, person)
+			report.Children++
+			continue
+		}
+		adults := 0
+		if family.Couple != "" {
+			adults = len(strings.Split(family.Couple, " & "))
+		}
+		family.People = append(family.People[:adults], append([]*Person{person}, family.People[adults:]...)...)
+		if adults == 0 {
+			family.Couple = person.Name
+		} else {
+			family.HasCouple = true
+			family.Couple += " & " + person.Name
+		}
+		report.Adults++
+	}
+
+	if len(families) == 0 {
+		return nil, report, errors.New("No families found in the membership data")
+	}
+	return families, report, nil
+}
@@ -0,0 +1,88 @@
+package membership
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseVCards(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/households.vcf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	families, report, err := ParseVCards(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		surname, couple, phone, address string
+		people                          []string
+	}{
+		// grouped by X-HOUSEHOLD even though Jane lists another address
+		{"Smith", "Smith, John & Smith, Jane", "801-555-1234", "123 Main St|Provo, UT 84601",
+			[]string{"Smith, John 801-555-0001 john@example.com", "Smith, Jane 801-555-0002", "Smith, Tommy 801-555-0003"}},
+		// grouped by home address, with the name from a folded FN
+		{"Jones", "Jones, Robert & Jones, Sue", "", "9 Elm St|Orem, UT 84057",
+			[]string{"Jones, Robert bob@example.com", "Jones, Sue"}},
+		{"Jones", "Jones, Ed", "", "1 Office Pl|Provo, UT 84601",
+			[]string{"Jones, Ed"}},
+	}
+	if len(families) != len(expected) {
+		t.Fatalf("found %d families, expected %d", len(families), len(expected))
+	}
+	for i, elt := range expected {
+		family := families[i]
+		if family.Surname != elt.surname || family.Couple != elt.couple || family.Phone != elt.phone {
+			t.Errorf("family %d is %s (%s) %q, expected %s (%s) %q",
+				i, family.Surname, family.Couple, family.Phone, elt.surname, elt.couple, elt.phone)
+		}
+		if address := strings.Join(family.Address, "|"); address != elt.address {
+			t.Errorf("family %d address is %q, expected %q", i, address, elt.address)
+		}
+		var people []string
+		for _, person := range family.People {
+			people = append(people, strings.Join(strings.Fields(person.Name+" "+person.Phone+" "+person.Email), " "))
+		}
+		if strings.Join(people, "\n") != strings.Join(elt.people, "\n") {
+			t.Errorf("family %d people are %q, expected %q", i, people, elt.people)
+		}
+	}
+
+	if report.Families != 3 || report.Adults != 5 || report.Children != 1 || report.Unclassified != 1 {
+		t.Errorf("report is %+v", report)
+	}
+	if len(report.Warnings) != 1 || report.Warnings[0].Where != "card 7" {
+		t.Errorf("expected a warning for card 7, found %+v", report.Warnings)
+	}
+}
+
+func TestVCardIsChild(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		lines string
+		child bool
+	}{
+		{"BDAY:2010-01-01", true},
+		{"BDAY:20081019", true},
+		{"BDAY:20081018", false},
+		{"BDAY:1975-04-01", false},
+		{"BDAY:--0401", false},
+		{"", false},
+
+		// the role wins over the birthday
+		{"BDAY:2010-01-01\nX-HOUSEHOLD-ROLE:adult", false},
+		{"BDAY:1975-04-01\nX-HOUSEHOLD-ROLE:Child", true},
+	}
+	for _, test := range tests {
+		cards := parseVCards([]byte("BEGIN:VCARD\nN:Smith;Pat\n" + test.lines + "\nEND:VCARD\n"))
+		if len(cards) != 1 {
+			t.Fatalf("found %d cards", len(cards))
+		}
+		if got := vcardIsChild(cards[0], now); got != test.child {
+			t.Errorf("%q: child is %v, expected %v", test.lines, got, test.child)
+		}
+	}
+}
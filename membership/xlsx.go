@@ -0,0 +1,242 @@
+//
+// Excel import
+// Code to read the first worksheet of an .xlsx file using only
+// archive/zip and encoding/xml, then build families from its rows
+// using the same column mapping as CSV files
+//
+
+package membership
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// the size of the largest worksheet Excel allows: columns A to XFD
+// and rows 1 to 1048576
+const (
+	xlsxMaxColumns = 16384
+	xlsxMaxRows    = 1048576
+)
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// rich text is split into runs, plain text is not
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (text *xlsxText) String() string {
+	s := text.T
+	for _, run := range text.Runs {
+		s += run.T
+	}
+	return s
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R      string   `xml:"r,attr"`
+			T      string   `xml:"t,attr"`
+			V      string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// read and parse one XML file from the archive
+// returns false if the file is not present
+func readZipXML(files map[string]*zip.File, name string, v interface{}) (bool, error) {
+	file, present := files[name]
+	if !present {
+		return false, nil
+	}
+	fp, err := file.Open()
+	if err != nil {
+		return true, err
+	}
+	defer fp.Close()
+	data, err := ioutil.ReadAll(fp)
+	if err != nil {
+		return true, err
+	}
+	if err = xml.Unmarshal(data, v); err != nil {
+		return true, fmt.Errorf("Parsing %s: %v", name, err)
+	}
+	return true, nil
+}
+
+// the column number of a cell reference like "AB12"
+// anything past the last column Excel allows gives xlsxMaxColumns
+func xlsxColumn(ref string) int {
+	col := 0
+	for _, c := range ref {
+		if c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		col = col*26 + int(c-'A'+1)
+		if col > xlsxMaxColumns {
+			return xlsxMaxColumns
+		}
+	}
+	return col - 1
+}
+
+// find the path of the first worksheet in the workbook
+func xlsxFirstSheet(files map[string]*zip.File) (string, error) {
+	var workbook xlsxWorkbook
+	var rels xlsxRelationships
+	found, err := readZipXML(files, "xl/workbook.xml", &workbook)
+	if err != nil {
+		return "", err
+	}
+	if found && len(workbook.Sheets) > 0 {
+		if _, err = readZipXML(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+			return "", err
+		}
+		for _, rel := range rels.Relationships {
+			if rel.ID != workbook.Sheets[0].ID {
+				continue
+			}
+			if strings.HasPrefix(rel.Target, "/") {
+				return strings.TrimPrefix(rel.Target, "/"), nil
+			}
+			return path.Join("xl", rel.Target), nil
+		}
+	}
+
+	// fall back to the usual name
+	if _, present := files["xl/worksheets/sheet1.xml"]; present {
+		return "xl/worksheets/sheet1.xml", nil
+	}
+	return "", errors.New("No worksheet found in the spreadsheet")
+}
+
+// load families from the first worksheet of an Excel file
+func (opts *Options) ParseXLSX(data []byte) ([]*Family, *ParseReport, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		log.Printf("Error opening spreadsheet: %v", err)
+		return nil, new(ParseReport), err
+	}
+	files := make(map[string]*zip.File)
+	for _, file := range archive.File {
+		files[strings.TrimPrefix(file.Name, "/")] = file
+	}
+
+	sheet, err := xlsxFirstSheet(files)
+	if err != nil {
+		log.Printf("Error finding worksheet: %v", err)
+		return nil, new(ParseReport), err
+	}
+	var shared xlsxSharedStrings
+	if _, err = readZipXML(files, "xl/sharedStrings.xml", &shared); err != nil {
+		log.Printf("Error reading shared strings: %v", err)
+		return nil, new(ParseReport), err
+	}
+	var worksheet xlsxWorksheet
+	found, err := readZipXML(files, sheet, &worksheet)
+	if err == nil && !found {
+		err = fmt.Errorf("Worksheet %s is missing from the spreadsheet", sheet)
+	}
+	if err != nil {
+		log.Printf("Error reading worksheet: %v", err)
+		return nil, new(ParseReport), err
+	}
+
+	// convert the cells to rows of strings
+	var records [][]string
+	for _, row := range worksheet.Rows {
+		// blank cells and rows are filled in below, so the file
+		// cannot be trusted to say how many there are
+		if row.R > xlsxMaxRows {
+			err = fmt.Errorf("Row %d is past the end of a worksheet", row.R)
+			log.Printf("Error reading worksheet: %v", err)
+			return nil, new(ParseReport), err
+		}
+		var record []string
+		for i, c := range row.Cells {
+			col := i
+			if c.R != "" {
+				col = xlsxColumn(c.R)
+			}
+			if col >= xlsxMaxColumns {
+				err = fmt.Errorf("Cell %s is past the end of a worksheet", c.R)
+				log.Printf("Error reading worksheet: %v", err)
+				return nil, new(ParseReport), err
+			}
+			if col < 0 || col < len(record) {
+				continue
+			}
+			for len(record) < col {
+				record = append(record, "")
+			}
+
+			var value string
+			switch c.T {
+			case "s":
+				if n, err := strconv.Atoi(strings.TrimSpace(c.V)); err == nil && n >= 0 && n < len(shared.Items) {
+					value = shared.Items[n].String()
+				}
+			case "inlineStr":
+				value = c.Inline.String()
+			case "str", "e":
+				value = c.V
+			case "b":
+				value = map[string]string{"0": "FALSE", "1": "TRUE"}[c.V]
+			default:
+				// numbers: phone numbers and zip codes are often stored this way
+				value = c.V
+				if f, err := strconv.ParseFloat(c.V, 64); err == nil {
+					value = strconv.FormatFloat(f, 'f', -1, 64)
+				}
+			}
+			record = append(record, value)
+		}
+
+		// keep blank rows as blank records
+		for row.R > len(records)+1 {
+			records = append(records, nil)
+		}
+		records = append(records, record)
+	}
+
+	// skip blank rows before the header
+	for len(records) > 0 && strings.TrimSpace(strings.Join(records[0], "")) == "" {
+		records = records[1:]
+	}
+
+	return familiesFromRecords(records, &opts.ColumnMapping)
+}
@@ -0,0 +1,107 @@
+package membership
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var testMapping = ColumnMapping{
+	Household: "Household",
+	Surname:   "Surname",
+	Head:      "Head",
+	Spouse:    "Spouse",
+	Children:  "Children",
+	Phone:     "Phone",
+	Email:     "Email",
+	Address:   "Address, City",
+}
+
+// a workbook with only the parts the importer reads
+func testXLSX(t *testing.T, shared []string, rows string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	var sst strings.Builder
+	sst.WriteString(`<?xml version="1.0" encoding="UTF-8"?><sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	for _, s := range shared {
+		sst.WriteString("<si><t>" + s + "</t></si>")
+	}
+	sst.WriteString("</sst>")
+	files := []struct{ name, body string }{
+		{"xl/sharedStrings.xml", sst.String()},
+		{"xl/worksheets/sheet1.xml", `<?xml version="1.0" encoding="UTF-8"?>` +
+			`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+			rows + `</sheetData></worksheet>`},
+	}
+	for _, file := range files {
+		fp, err := w.Create(file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fp.Write([]byte(file.body))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseXLSX(t *testing.T) {
+	shared := []string{"Surname", "Head", "Phone", "Address", "Smith", "Smith, John", "123 Main St"}
+	rows := `<row r="1">` +
+		`<c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c>` +
+		`<c r="D1" t="s"><v>2</v></c><c r="E1" t="s"><v>3</v></c></row>` +
+		// the blank column C and the blank row 3 are left out
+		`<row r="2">` +
+		`<c r="A2" t="s"><v>4</v></c><c r="B2" t="s"><v>5</v></c>` +
+		`<c r="D2"><v>8015551234</v></c><c r="E2" t="s"><v>6</v></c></row>` +
+		`<row r="4">` +
+		`<c r="A4" t="inlineStr"><is><t>Jones</t></is></c>` +
+		`<c r="B4" t="inlineStr"><is><r><t>Mary </t></r><r><t>Jones</t></r></is></c>` +
+		`<c r="D4" t="str"><v>801-555-9876</v></c></row>`
+
+	opts := &Options{ColumnMapping: testMapping}
+	families, report, err := opts.ParseXLSX(testXLSX(t, shared, rows))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 2 || report.Families != 2 || report.Adults != 2 {
+		t.Fatalf("found %d families with report %+v, expected 2 families and 2 adults", len(families), report)
+	}
+
+	smith := families[0]
+	if smith.Surname != "Smith" || smith.Couple != "Smith, John" || smith.Phone != "8015551234" ||
+		len(smith.Address) != 1 || smith.Address[0] != "123 Main St" {
+		t.Errorf("first family is %+v", smith)
+	}
+	jones := families[1]
+	if jones.Surname != "Jones" || jones.Couple != "Jones, Mary Jones" || jones.Phone != "801-555-9876" {
+		t.Errorf("second family is %+v", jones)
+	}
+}
+
+func TestParseXLSXLimits(t *testing.T) {
+	header := `<row r="1"><c r="A1" t="inlineStr"><is><t>Surname</t></is></c></row>`
+	tests := []string{
+		// one past column XFD
+		`<row r="2"><c r="XFE2" t="inlineStr"><is><t>Smith</t></is></c></row>`,
+		`<row r="2"><c r="ZZZZZZZZZZZZZ2" t="inlineStr"><is><t>Smith</t></is></c></row>`,
+		// one past the last row
+		`<row r="1048577"><c t="inlineStr"><is><t>Smith</t></is></c></row>`,
+		`<row r="2000000000"><c t="inlineStr"><is><t>Smith</t></is></c></row>`,
+	}
+	opts := &Options{ColumnMapping: testMapping}
+	for _, rows := range tests {
+		if _, _, err := opts.ParseXLSX(testXLSX(t, nil, header+rows)); err == nil {
+			t.Errorf("expected an error for %s", rows)
+		}
+	}
+
+	// the last column is allowed
+	rows := header + `<row r="2"><c r="A2" t="inlineStr"><is><t>Smith</t></is></c>` +
+		`<c r="XFD2" t="inlineStr"><is><t>extra</t></is></c></row>`
+	if families, _, err := opts.ParseXLSX(testXLSX(t, nil, rows)); err != nil || len(families) != 1 {
+		t.Errorf("column XFD: found %d families, error %v", len(families), err)
+	}
+}
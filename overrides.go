@@ -0,0 +1,362 @@
+//
+// Household overrides
+// Corrections kept on this computer and applied to the membership data
+// every time: add households that are missing from the export, hide
+// households that asked not to be published, and fix individual details
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/russross/warddirectory/membership"
+)
+
+var overridesPath = homeFile(".warddirectory-overrides.json")
+
+// the kinds of override
+const (
+	OverrideAdd     = "add"
+	OverrideHide    = "hide"
+	OverrideEdit    = "edit"
+	OverrideReplace = "replace"
+)
+
+// a single correction to the membership data
+//
+// hide and edit find their family by surname plus couple, or surname
+// plus address, the same way families are matched between files
+//
+// add uses Surname, Address, Phone, Email, and People to make a new
+// family; the adults are listed first and named in Couple
+//
+// edit replaces the family's phone, email, and address with any that
+// are given, and if Person names someone in the family, replaces that
+// person's name, phone, and email with any that are given
+//
+// replace swaps the whole listing for Family, keeping the photo;
+// the household editor saves its changes this way
+type Override struct {
+	Action string
+	Note   string `json:",omitempty"`
+
+	Surname string
+	Couple  string               `json:",omitempty"`
+	Address []string             `json:",omitempty"`
+	Phone   string               `json:",omitempty"`
+	Email   string               `json:",omitempty"`
+	People  []*membership.Person `json:",omitempty"`
+
+	NewAddress  []string `json:",omitempty"`
+	Person      string   `json:",omitempty"`
+	PersonName  string   `json:",omitempty"`
+	PersonPhone string   `json:",omitempty"`
+	PersonEmail string   `json:",omitempty"`
+
+	Family *membership.Family `json:",omitempty"`
+}
+
+// a short description of the override, for the report and web page
+func (override *Override) String() string {
+	label := override.Surname
+	if override.Couple != "" {
+		label += " (" + override.Couple + ")"
+	} else if len(override.Address) > 0 {
+		label += " (" + strings.Join(override.Address, ", ") + ")"
+	}
+	switch override.Action {
+	case OverrideAdd:
+		return "add " + label
+	case OverrideHide:
+		return "hide " + label
+	case OverrideEdit:
+		var changes []string
+		if override.Phone != "" {
+			changes = append(changes, "phone "+override.Phone)
+		}
+		if override.Email != "" {
+			changes = append(changes, "email "+override.Email)
+		}
+		if len(override.NewAddress) > 0 {
+			changes = append(changes, "address "+strings.Join(override.NewAddress, ", "))
+		}
+		if override.Person != "" {
+			var person []string
+			if override.PersonName != "" {
+				person = append(person, "name "+override.PersonName)
+			}
+			if override.PersonPhone != "" {
+				person = append(person, "phone "+override.PersonPhone)
+			}
+			if override.PersonEmail != "" {
+				person = append(person, "email "+override.PersonEmail)
+			}
+			changes = append(changes, override.Person+": "+strings.Join(person, ", "))
+		}
+		return "edit " + label + ": " + strings.Join(changes, "; ")
+	case OverrideReplace:
+		if override.Family == nil {
+			return "replace " + label
+		}
+		var names []string
+		for _, person := range override.Family.People {
+			if person != nil {
+				names = append(names, person.Name)
+			}
+		}
+		return "replace " + label + " with " + override.Family.Surname + ": " + strings.Join(names, ", ")
+	}
+	return override.Action + " " + label
+}
+
+// check that an override makes sense before it is saved or used
+func (override *Override) Validate() error {
+	if strings.TrimSpace(override.Surname) == "" {
+		return errors.New("An override needs a surname")
+	}
+	switch override.Action {
+	case OverrideAdd:
+		if len(override.People) == 0 {
+			return errors.New("An added household needs at least one person")
+		}
+		if err := checkPeople(override.People); err != nil {
+			return err
+		}
+	case OverrideHide, OverrideEdit, OverrideReplace:
+		if override.Couple == "" && len(override.Address) == 0 {
+			return errors.New("To find the household, give the couple or the address as well as the surname")
+		}
+		if override.Action == OverrideReplace && (override.Family == nil || strings.TrimSpace(override.Family.Surname) == "") {
+			return errors.New("A household needs a surname")
+		}
+		if override.Action == OverrideReplace && len(override.Family.People) == 0 {
+			return errors.New("A household needs at least one person")
+		}
+		if override.Action == OverrideReplace {
+			if err := checkPeople(override.Family.People); err != nil {
+				return err
+			}
+		}
+		if override.Action == OverrideEdit && override.Phone == "" && override.Email == "" && len(override.NewAddress) == 0 &&
+			(override.Person == "" || override.PersonName == "" && override.PersonPhone == "" && override.PersonEmail == "") {
+			return errors.New("An edit needs at least one new value")
+		}
+	default:
+		return fmt.Errorf("Unknown override action %q", override.Action)
+	}
+	return nil
+}
+
+// hand-edited files can have empty entries in a list of people
+func checkPeople(people []*membership.Person) error {
+	for _, person := range people {
+		if person == nil {
+			return errors.New("A household has an empty entry in its list of people")
+		}
+	}
+	return nil
+}
+
+// does the override apply to this family?
+func (override *Override) Matches(family *membership.Family) bool {
+	keys := membership.FamilyKeys(&membership.Family{Surname: override.Surname, Couple: override.Couple, Address: override.Address})
+	for _, key := range membership.FamilyKeys(family) {
+		for _, elt := range keys {
+			if key == elt {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// load the saved overrides; a missing file means there are none
+func LoadOverrides() ([]*Override, error) {
+	return ReadOverrides(overridesPath)
+}
+
+// load overrides from a file; a missing file means there are none
+// the file can be edited by hand, so overrides that do not make sense
+// are skipped with a warning instead of being applied
+func ReadOverrides(path string) ([]*Override, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var all []*Override
+	if err = json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("Parsing %s: %v", path, err)
+	}
+
+	var overrides []*Override
+	for i, override := range all {
+		if override == nil {
+			log.Printf("Skipping override %d in %s: it is empty", i+1, path)
+			continue
+		}
+		if err := override.Validate(); err != nil {
+			log.Printf("Skipping override %d in %s (%s): %v", i+1, path, override, err)
+			continue
+		}
+		overrides = append(overrides, override)
+	}
+	return overrides, nil
+}
+
+// save the overrides, leaving ampersands alone so the file is easy to edit
+func SaveOverrides(overrides []*Override) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(overrides); err != nil {
+		return err
+	}
+	log.Printf("Saving overrides to %s", overridesPath)
+
+	// write it alongside and move it into place, so a directory being
+	// generated never reads a half-written file
+	tmp := overridesPath + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, overridesPath)
+}
+
+// apply the overrides saved on this computer
+func (dir *Directory) ApplySavedOverrides() error {
+	overrides, err := LoadOverrides()
+	if err != nil {
+		return fmt.Errorf("loading overrides: %v", err)
+	}
+	dir.ApplyOverrides(overrides)
+	return nil
+}
+
+// apply the overrides to the families, in order
+// overrides that no longer match any family are reported
+func (dir *Directory) ApplyOverrides(overrides []*Override) {
+	if dir.Report == nil {
+		dir.Report = new(membership.ParseReport)
+	}
+	report := dir.Report
+
+	for i, override := range overrides {
+		where := fmt.Sprintf("override %d", i+1)
+		if override == nil {
+			continue
+		}
+		if err := override.Validate(); err != nil {
+			report.Warn(where, nil, override.String(), "override skipped: %v", err)
+			continue
+		}
+
+		if override.Action == OverrideAdd {
+			family := &membership.Family{
+				Surname: override.Surname,
+				Address: append([]string(nil), override.Address...),
+				Phone:   override.Phone,
+				Email:   override.Email,
+			}
+			for _, person := range override.People {
+				elt := *person
+				family.People = append(family.People, &elt)
+			}
+
+			// with no couple given, the first person is the head
+			family.Couple = override.Couple
+			if family.Couple == "" {
+				family.Couple = family.People[0].Name
+			}
+			family.HasCouple = membership.CoupleSize(family) > 1
+			dir.Families = append(dir.Families, family)
+			report.Added++
+			continue
+		}
+
+		matched := false
+		var kept []*membership.Family
+		for _, family := range dir.Families {
+			if !override.Matches(family) {
+				kept = append(kept, family)
+				continue
+			}
+			matched = true
+			switch override.Action {
+			case OverrideHide:
+				report.Hidden++
+			case OverrideEdit:
+				if !override.edit(family) {
+					report.Warn(where, family, override.Person, "override names a person who is not in the family")
+				}
+				report.Edited++
+				kept = append(kept, family)
+			case OverrideReplace:
+				override.replace(family)
+				report.Edited++
+				kept = append(kept, family)
+			}
+		}
+		dir.Families = kept
+
+		if !matched {
+			report.Warn(where, nil, override.String(), "override no longer matches any family")
+		}
+	}
+}
+
+// apply an edit override to a matching family
+// returns false if the person to edit was not found
+func (override *Override) edit(family *membership.Family) bool {
+	if override.Phone != "" {
+		family.Phone = override.Phone
+	}
+	if override.Email != "" {
+		family.Email = override.Email
+	}
+	if len(override.NewAddress) > 0 {
+		family.Address = append([]string(nil), override.NewAddress...)
+	}
+	if override.Person == "" {
+		return true
+	}
+
+	key := membership.NameKey(override.Person)
+	for _, person := range family.People {
+		if membership.NameKey(person.Name) != key {
+			continue
+		}
+		if override.PersonName != "" {
+			// keep the couple in step with the new name
+			family.Couple = strings.Replace(family.Couple, person.Name, override.PersonName, 1)
+			person.Name = override.PersonName
+		}
+		if override.PersonPhone != "" {
+			person.Phone = override.PersonPhone
+		}
+		if override.PersonEmail != "" {
+			person.Email = override.PersonEmail
+		}
+		return true
+	}
+	return false
+}
+
+// apply a replace override to a matching family
+func (override *Override) replace(family *membership.Family) {
+	elt := override.Family.Copy()
+	elt.HasCouple = membership.CoupleSize(elt) > 1
+	elt.New = family.New
+	elt.Photo = family.Photo
+	*family = *elt
+}
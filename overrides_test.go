@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/russross/warddirectory/membership"
+)
+
+func TestReadOverridesSkipsInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overrides")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "overrides.json")
+	data := `[
+		{"Action": "add", "Surname": "Empty"},
+		{"Action": "add", "Surname": "Nobody", "People": [null]},
+		{"Action": "replace", "Surname": "Smith", "Couple": "John"},
+		{"Action": "replace", "Surname": "Smith", "Couple": "John", "Family": {"Surname": "Smith", "People": [null]}},
+		null,
+		{"Action": "hide", "Surname": "Jones", "Couple": "Mary"}
+	]`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	overrides, err := ReadOverrides(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overrides) != 1 || overrides[0].Action != OverrideHide {
+		t.Fatalf("expected only the hide override, found %v", overrides)
+	}
+}
+
+func TestApplyInvalidOverrides(t *testing.T) {
+	dir := &Directory{
+		Families: []*membership.Family{
+			{Surname: "Smith", Couple: "John", People: []*membership.Person{{Name: "John"}}},
+		},
+	}
+	dir.ApplyOverrides([]*Override{
+		{Action: OverrideAdd, Surname: "Empty"},
+		{Action: OverrideReplace, Surname: "Smith", Couple: "John"},
+		nil,
+	})
+	if len(dir.Families) != 1 || dir.Families[0].Couple != "John" {
+		t.Errorf("invalid overrides changed the families")
+	}
+	if len(dir.Report.Warnings) != 2 {
+		t.Errorf("expected 2 warnings, found %d", len(dir.Report.Warnings))
+	}
+}
+
+// overrides added from several pages at once must all be kept
+func TestConcurrentOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overrides")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	old := overridesPath
+	overridesPath = filepath.Join(dir, "overrides.json")
+	defer func() { overridesPath = old }()
+
+	gen, err := NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// even with one CPU, let the pages run at the same time
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	const count = 20
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			form := url.Values{
+				"SubmitButton": {"Add override"},
+				"Action":       {OverrideHide},
+				"Surname":      {fmt.Sprintf("Family%02d", i)},
+				"Couple":       {"Pat"},
+			}
+			req := httptest.NewRequest("POST", "/overrides", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			overridesPage(rec, req, gen)
+			if rec.Code != 302 {
+				t.Errorf("override %d: status %d: %s", i, rec.Code, rec.Body.String())
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	overrides, err := LoadOverrides()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overrides) != count {
+		t.Errorf("expected %d overrides, found %d", count, len(overrides))
+	}
+}
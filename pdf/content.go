@@ -0,0 +1,297 @@
+//
+// PDF content streams
+// Code to tokenize a page's content stream and interpret the
+// operators that place text on the page
+//
+
+package pdf
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"unicode/utf8"
+)
+
+// a fill color, converted to RGB
+type RGB [3]float64
+
+// a transformation matrix [a b c d e f]
+type Matrix [6]float64
+
+var Identity = Matrix{1, 0, 0, 1, 0, 0}
+
+// compute m × n
+func (m Matrix) Multiply(n Matrix) Matrix {
+	return Matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+// the parts of the graphics state that matter for extracting text
+type graphicsState struct {
+	ctm     Matrix
+	fill    RGB
+	font    string
+	size    float64
+	leading float64
+}
+
+// a string of text shown by a single operator
+type TextRun struct {
+	Page  int
+	Font  string
+	Size  float64
+	Color RGB
+	X     float64
+	Y     float64
+	Text  string
+}
+
+// interpret a content stream, reporting each string of text that it shows
+// positions are where each string starts; glyph widths are not tracked
+// external objects (images and forms) are passed to XObject by name,
+// along with the matrix that maps the unit square onto the page
+type ContentInterpreter struct {
+	page     int
+	state    graphicsState
+	stack    []graphicsState
+	tm       Matrix
+	tlm      Matrix
+	operands []Object
+
+	Text    func(run *TextRun)
+	XObject func(name string, ctm Matrix)
+}
+
+// start interpreting a page, or a form drawn on it with the given
+// transformation matrix
+func NewContentInterpreter(page int, ctm Matrix) *ContentInterpreter {
+	return &ContentInterpreter{
+		page:  page,
+		state: graphicsState{ctm: ctm},
+		tm:    Identity,
+		tlm:   Identity,
+	}
+}
+
+func (ci *ContentInterpreter) Run(contents []byte) error {
+	p := &pdfParser{data: contents}
+	for {
+		obj, err := p.next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		op, isOp := obj.(pdfKeyword)
+		if !isOp {
+			ci.operands = append(ci.operands, obj)
+			continue
+		}
+
+		if op == "BI" {
+			skipInlineImage(p)
+		} else {
+			ci.do(string(op))
+		}
+		ci.operands = ci.operands[:0]
+	}
+}
+
+// get a numeric operand, counting from the end of the list
+func (ci *ContentInterpreter) num(fromEnd int) float64 {
+	i := len(ci.operands) - fromEnd
+	if i < 0 {
+		return 0
+	}
+	n, _ := ci.operands[i].(Number)
+	return float64(n)
+}
+
+func (ci *ContentInterpreter) matrixOperand() Matrix {
+	return Matrix{ci.num(6), ci.num(5), ci.num(4), ci.num(3), ci.num(2), ci.num(1)}
+}
+
+func (ci *ContentInterpreter) do(op string) {
+	switch op {
+	// graphics state
+	case "q":
+		ci.stack = append(ci.stack, ci.state)
+	case "Q":
+		if len(ci.stack) > 0 {
+			ci.state = ci.stack[len(ci.stack)-1]
+			ci.stack = ci.stack[:len(ci.stack)-1]
+		}
+	case "cm":
+		ci.state.ctm = ci.matrixOperand().Multiply(ci.state.ctm)
+	case "Do":
+		if ci.XObject != nil && len(ci.operands) > 0 {
+			if name, isName := ci.operands[len(ci.operands)-1].(Name); isName {
+				ci.XObject(string(name), ci.state.ctm)
+			}
+		}
+
+	// fill color
+	case "g":
+		gray := ci.num(1)
+		ci.state.fill = RGB{gray, gray, gray}
+	case "rg":
+		ci.state.fill = RGB{ci.num(3), ci.num(2), ci.num(1)}
+	case "k":
+		ci.state.fill = cmykToRGB(ci.num(4), ci.num(3), ci.num(2), ci.num(1))
+	case "cs":
+		ci.state.fill = RGB{}
+	case "sc", "scn":
+		// the color space is not tracked, so guess from the operand count
+		var n []float64
+		for _, elt := range ci.operands {
+			if num, isNum := elt.(Number); isNum {
+				n = append(n, float64(num))
+			}
+		}
+		switch len(n) {
+		case 1:
+			ci.state.fill = RGB{n[0], n[0], n[0]}
+		case 3:
+			ci.state.fill = RGB{n[0], n[1], n[2]}
+		case 4:
+			ci.state.fill = cmykToRGB(n[0], n[1], n[2], n[3])
+		}
+
+	// text objects and state
+	case "BT":
+		ci.tm = Identity
+		ci.tlm = Identity
+	case "Tf":
+		if len(ci.operands) >= 2 {
+			name, _ := ci.operands[len(ci.operands)-2].(Name)
+			ci.state.font = string(name)
+		}
+		ci.state.size = ci.num(1)
+	case "TL":
+		ci.state.leading = ci.num(1)
+
+	// text positioning
+	case "Tm":
+		ci.tm = ci.matrixOperand()
+		ci.tlm = ci.tm
+	case "Td":
+		ci.moveText(ci.num(2), ci.num(1))
+	case "TD":
+		ci.state.leading = -ci.num(1)
+		ci.moveText(ci.num(2), ci.num(1))
+	case "T*":
+		ci.moveText(0, -ci.state.leading)
+
+	// text showing
+	case "Tj":
+		if len(ci.operands) > 0 {
+			s, _ := ci.operands[len(ci.operands)-1].(String)
+			ci.show(string(s))
+		}
+	case "'", "\"":
+		ci.moveText(0, -ci.state.leading)
+		if len(ci.operands) > 0 {
+			s, _ := ci.operands[len(ci.operands)-1].(String)
+			ci.show(string(s))
+		}
+	case "TJ":
+		if len(ci.operands) > 0 {
+			lst, _ := ci.operands[len(ci.operands)-1].(Slice)
+			ci.show(joinTJ(lst))
+		}
+	}
+}
+
+func (ci *ContentInterpreter) moveText(tx, ty float64) {
+	ci.tlm = Matrix{1, 0, 0, 1, tx, ty}.Multiply(ci.tlm)
+	ci.tm = ci.tlm
+}
+
+func (ci *ContentInterpreter) show(raw string) {
+	if ci.Text == nil {
+		return
+	}
+
+	// the font size in text space, including any scaling from the text matrix
+	size := ci.state.size * math.Hypot(ci.tm[2], ci.tm[3])
+	size = math.Floor(size*100+0.5) / 100
+
+	trm := ci.tm.Multiply(ci.state.ctm)
+	ci.Text(&TextRun{
+		Page:  ci.page,
+		Font:  ci.state.font,
+		Size:  size,
+		Color: ci.state.fill,
+		X:     trm[4],
+		Y:     trm[5],
+		Text:  decodeText(raw),
+	})
+}
+
+// join the strings of a TJ array
+// a large enough negative adjustment is treated as a space
+func joinTJ(lst Slice) string {
+	var buf bytes.Buffer
+	for _, elt := range lst {
+		switch elt := elt.(type) {
+		case String:
+			buf.WriteString(string(elt))
+		case Number:
+			if elt < -250 && buf.Len() > 0 && buf.Bytes()[buf.Len()-1] != ' ' {
+				buf.WriteByte(' ')
+			}
+		}
+	}
+	return buf.String()
+}
+
+// do we have non-utf8 text? assume it is WinAnsiEncoding and convert
+func decodeText(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+	runes := make([]rune, len(s))
+	for i := 0; i < len(s); i++ {
+		runes[i] = rune(s[i])
+	}
+	return string(runes)
+}
+
+func cmykToRGB(c, m, y, k float64) RGB {
+	return RGB{(1 - c) * (1 - k), (1 - m) * (1 - k), (1 - y) * (1 - k)}
+}
+
+// skip over an inline image: BI <dictionary pairs> ID <binary data> EI
+func skipInlineImage(p *pdfParser) {
+	for {
+		obj, err := p.next()
+		if err != nil {
+			return
+		}
+		if obj == pdfKeyword("ID") {
+			break
+		}
+	}
+
+	// the data starts after a single whitespace character and
+	// ends with EI surrounded by whitespace
+	p.pos++
+	for p.pos+2 <= len(p.data) {
+		if p.data[p.pos] == 'E' && p.data[p.pos+1] == 'I' &&
+			isPDFSpace(p.data[p.pos-1]) &&
+			(p.pos+2 == len(p.data) || !isPDFRegular(p.data[p.pos+2])) {
+			p.pos += 2
+			return
+		}
+		p.pos++
+	}
+	p.pos = len(p.data)
+}
@@ -0,0 +1,325 @@
+//
+// PDF decryption
+// Code to open files protected by the standard security handler
+// with an empty user password, as produced by some browsers
+//
+
+package pdf
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rc4"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// the padding string used to build keys from passwords
+var passwordPadding = []byte{
+	0x28, 0xbf, 0x4e, 0x5e, 0x4e, 0x75, 0x8a, 0x41,
+	0x64, 0x00, 0x4e, 0x56, 0xff, 0xfa, 0x01, 0x08,
+	0x2e, 0x2e, 0x00, 0xb6, 0xd0, 0x68, 0x3e, 0x80,
+	0x2f, 0x0c, 0xa9, 0xfe, 0x64, 0x53, 0x69, 0x7a,
+}
+
+var errPasswordRequired = errors.New("The PDF file is protected by a password; save it again without a password")
+
+// crypt filter methods
+const (
+	cryptNone   = "None"
+	cryptRC4    = "V2"
+	cryptAES    = "AESV2"
+	cryptAES256 = "AESV3"
+)
+
+type pdfDecrypter struct {
+	key             []byte
+	stringMethod    string
+	streamMethod    string
+	encryptMetadata bool
+}
+
+func newDecrypter(encrypt Map, id []byte) (*pdfDecrypter, error) {
+	if encrypt["Filter"] != Name("Standard") {
+		return nil, fmt.Errorf("Unsupported PDF security handler: %v", encrypt["Filter"])
+	}
+	v := pdfInt(encrypt["V"], 0)
+	r := pdfInt(encrypt["R"], 0)
+	o, _ := encrypt["O"].(String)
+	u, _ := encrypt["U"].(String)
+	p := uint32(int32(pdfInt(encrypt["P"], 0)))
+	encryptMetadata := true
+	if b, isBool := encrypt["EncryptMetadata"].(Bool); isBool {
+		encryptMetadata = bool(b)
+	}
+
+	d := &pdfDecrypter{stringMethod: cryptRC4, streamMethod: cryptRC4, encryptMetadata: encryptMetadata}
+	length := pdfInt(encrypt["Length"], 40) / 8
+
+	// version 4 and up name their crypt filters
+	if v >= 4 {
+		filters, _ := encrypt["CF"].(Map)
+		method := func(name Object) (string, error) {
+			if name == nil || name == Name("Identity") {
+				return cryptNone, nil
+			}
+			n, ok := name.(Name)
+			if !ok {
+				return "", fmt.Errorf("Unsupported PDF crypt filter: %v", name)
+			}
+			cf, ok := filters[string(n)].(Map)
+			if !ok {
+				return "", fmt.Errorf("Unsupported PDF crypt filter: %s", n)
+			}
+			cfm, _ := cf["CFM"].(Name)
+			if n := pdfInt(cf["Length"], 0); n > 0 && v == 4 {
+				// sometimes given in bytes, sometimes in bits
+				if n > 32 {
+					n /= 8
+				}
+				length = n
+			}
+			switch cfm {
+			case "", cryptNone:
+				return cryptNone, nil
+			case cryptRC4, cryptAES, cryptAES256:
+				return string(cfm), nil
+			}
+			return "", fmt.Errorf("Unsupported PDF crypt filter method: %s", cfm)
+		}
+		var err error
+		if d.stringMethod, err = method(encrypt["StrF"]); err != nil {
+			return nil, err
+		}
+		if d.streamMethod, err = method(encrypt["StmF"]); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case r <= 4:
+		if r == 2 {
+			length = 5
+		}
+		if length < 5 || length > 16 {
+			length = 16
+		}
+
+		// compute the key from the empty password
+		h := md5.New()
+		h.Write(passwordPadding)
+		h.Write([]byte(o))
+		h.Write([]byte{byte(p), byte(p >> 8), byte(p >> 16), byte(p >> 24)})
+		h.Write(id)
+		if r >= 4 && !encryptMetadata {
+			h.Write([]byte{0xff, 0xff, 0xff, 0xff})
+		}
+		key := h.Sum(nil)
+		if r >= 3 {
+			for i := 0; i < 50; i++ {
+				sum := md5.Sum(key[:length])
+				key = sum[:]
+			}
+		}
+		d.key = key[:length]
+
+		// check it against the user password entry
+		if r == 2 {
+			if !bytes.Equal(rc4Crypt(d.key, passwordPadding), []byte(u)) {
+				return nil, errPasswordRequired
+			}
+		} else {
+			h := md5.New()
+			h.Write(passwordPadding)
+			h.Write(id)
+			check := h.Sum(nil)
+			for i := 0; i < 20; i++ {
+				k := make([]byte, len(d.key))
+				for j := range k {
+					k[j] = d.key[j] ^ byte(i)
+				}
+				check = rc4Crypt(k, check)
+			}
+			if len(u) < 16 || !bytes.Equal(check, []byte(u[:16])) {
+				return nil, errPasswordRequired
+			}
+		}
+
+	case r == 5 || r == 6:
+		ue, _ := encrypt["UE"].(String)
+		if len(u) < 48 || len(ue) < 32 {
+			return nil, errors.New("Malformed PDF encryption dictionary")
+		}
+		validation, keySalt := []byte(u[32:40]), []byte(u[40:48])
+		if !bytes.Equal(hash2B(r, nil, validation), []byte(u[:32])) {
+			return nil, errPasswordRequired
+		}
+
+		// the file key is encrypted with a key derived from the password
+		block, err := aes.NewCipher(hash2B(r, nil, keySalt))
+		if err != nil {
+			return nil, err
+		}
+		d.key = make([]byte, 32)
+		cipher.NewCBCDecrypter(block, make([]byte, 16)).CryptBlocks(d.key, []byte(ue[:32]))
+
+	default:
+		return nil, fmt.Errorf("Unsupported PDF encryption revision: %d", r)
+	}
+
+	return d, nil
+}
+
+// the password hash for revisions 5 and 6 (user password only)
+func hash2B(r int, password, salt []byte) []byte {
+	h := sha256.New()
+	h.Write(password)
+	h.Write(salt)
+	k := h.Sum(nil)
+	if r == 5 {
+		return k
+	}
+
+	for i := 0; ; i++ {
+		var k1 []byte
+		for j := 0; j < 64; j++ {
+			k1 = append(k1, password...)
+			k1 = append(k1, k...)
+		}
+		block, _ := aes.NewCipher(k[:16])
+		e := make([]byte, len(k1))
+		cipher.NewCBCEncrypter(block, k[16:32]).CryptBlocks(e, k1)
+
+		sum := 0
+		for _, b := range e[:16] {
+			sum += int(b)
+		}
+		var next hash.Hash
+		switch sum % 3 {
+		case 0:
+			next = sha256.New()
+		case 1:
+			next = sha512.New384()
+		default:
+			next = sha512.New()
+		}
+		next.Write(e)
+		k = next.Sum(nil)
+
+		if i >= 63 && int(e[len(e)-1]) <= i+1-32 {
+			break
+		}
+	}
+	return k[:32]
+}
+
+func rc4Crypt(key, data []byte) []byte {
+	c, err := rc4.NewCipher(key)
+	if err != nil {
+		return nil
+	}
+	out := make([]byte, len(data))
+	c.XORKeyStream(out, data)
+	return out
+}
+
+// decrypt a string or stream belonging to an indirect object
+func (d *pdfDecrypter) decrypt(method string, num, gen int, data []byte) ([]byte, error) {
+	switch method {
+	case cryptNone:
+		return data, nil
+	case cryptAES256:
+		return aesDecrypt(d.key, data)
+	}
+
+	// the key is specific to each object
+	h := md5.New()
+	h.Write(d.key)
+	h.Write([]byte{byte(num), byte(num >> 8), byte(num >> 16), byte(gen), byte(gen >> 8)})
+	if method == cryptAES {
+		h.Write([]byte("sAlT"))
+	}
+	key := h.Sum(nil)
+	if n := len(d.key) + 5; n < 16 {
+		key = key[:n]
+	}
+
+	if method == cryptAES {
+		return aesDecrypt(key, data)
+	}
+	return rc4Crypt(key, data), nil
+}
+
+// AES-CBC with the IV in the first block and PKCS#5 padding
+func aesDecrypt(key, data []byte) ([]byte, error) {
+	if len(data) < 16 || len(data)%16 != 0 {
+		if len(data) == 0 {
+			return data, nil
+		}
+		return nil, errors.New("Malformed AES-encrypted data")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data)-16)
+	cipher.NewCBCDecrypter(block, data[:16]).CryptBlocks(out, data[16:])
+	if len(out) > 0 {
+		if pad := int(out[len(out)-1]); pad >= 1 && pad <= 16 && pad <= len(out) {
+			out = out[:len(out)-pad]
+		}
+	}
+	return out, nil
+}
+
+// decrypt every string and stream in an indirect object
+func (d *pdfDecrypter) decryptObject(obj Object, num, gen int) (Object, error) {
+	switch elt := obj.(type) {
+	case String:
+		data, err := d.decrypt(d.stringMethod, num, gen, []byte(elt))
+		if err != nil {
+			return nil, err
+		}
+		return String(data), nil
+
+	case Slice:
+		for i, val := range elt {
+			var err error
+			if elt[i], err = d.decryptObject(val, num, gen); err != nil {
+				return nil, err
+			}
+		}
+		return elt, nil
+
+	case Map:
+		for key, val := range elt {
+			var err error
+			if elt[key], err = d.decryptObject(val, num, gen); err != nil {
+				return nil, err
+			}
+		}
+		return elt, nil
+
+	case *Stream:
+		// cross-reference streams are never encrypted, and metadata may not be
+		if elt.Map["Type"] == Name("XRef") || (elt.Map["Type"] == Name("Metadata") && !d.encryptMetadata) {
+			return elt, nil
+		}
+		if _, err := d.decryptObject(elt.Map, num, gen); err != nil {
+			return nil, err
+		}
+		data, err := d.decrypt(d.streamMethod, num, gen, elt.Data)
+		if err != nil {
+			return nil, err
+		}
+		elt.Data = data
+		return elt, nil
+	}
+
+	return obj, nil
+}
@@ -0,0 +1,251 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rc4"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// the encrypting side of the standard security handler, written from
+// the specification, for making test files with an empty user password
+type testEncrypter struct {
+	revision int
+	method   string
+	key      []byte
+	dict     string
+}
+
+var testID = []byte("0123456789abcdef")
+
+func testRC4(key, data []byte) []byte {
+	c, err := rc4.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	out := make([]byte, len(data))
+	c.XORKeyStream(out, data)
+	return out
+}
+
+// AES-CBC with the IV first and PKCS#5 padding, or no padding and a
+// zero IV for the file key
+func testAES(key, iv, data []byte, pad bool) []byte {
+	if pad {
+		n := 16 - len(data)%16
+		data = append(append([]byte(nil), data...), bytes.Repeat([]byte{byte(n)}, n)...)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, data)
+	if pad {
+		return append(append([]byte(nil), iv...), out...)
+	}
+	return out
+}
+
+// algorithm 2.B with an empty password
+func testHash(revision int, salt []byte) []byte {
+	sum := sha256.Sum256(salt)
+	k := sum[:]
+	if revision == 5 {
+		return k
+	}
+	for round := 1; ; round++ {
+		k1 := bytes.Repeat(k, 64)
+		e := make([]byte, len(k1))
+		block, _ := aes.NewCipher(k[:16])
+		cipher.NewCBCEncrypter(block, k[16:32]).CryptBlocks(e, k1)
+		n := 0
+		for _, b := range e[:16] {
+			n += int(b)
+		}
+		switch n % 3 {
+		case 0:
+			s := sha256.Sum256(e)
+			k = s[:]
+		case 1:
+			s := sha512.Sum384(e)
+			k = s[:]
+		default:
+			s := sha512.Sum512(e)
+			k = s[:]
+		}
+		if round >= 64 && int(e[len(e)-1]) <= round-32 {
+			return k[:32]
+		}
+	}
+}
+
+func hexString(data []byte) string {
+	return "<" + hex.EncodeToString(data) + ">"
+}
+
+func newTestEncrypter(revision int) *testEncrypter {
+	padding := []byte{
+		0x28, 0xbf, 0x4e, 0x5e, 0x4e, 0x75, 0x8a, 0x41,
+		0x64, 0x00, 0x4e, 0x56, 0xff, 0xfa, 0x01, 0x08,
+		0x2e, 0x2e, 0x00, 0xb6, 0xd0, 0x68, 0x3e, 0x80,
+		0x2f, 0x0c, 0xa9, 0xfe, 0x64, 0x53, 0x69, 0x7a,
+	}
+	e := &testEncrypter{revision: revision}
+
+	if revision >= 5 {
+		e.method = cryptAES256
+		e.key = []byte("a file key of thirty-two bytes!!")
+		validation, keySalt := []byte("vsalt123"), []byte("ksalt456")
+		u := append(append(testHash(revision, validation), validation...), keySalt...)
+		ue := testAES(testHash(revision, keySalt), make([]byte, 16), e.key, false)
+		e.dict = fmt.Sprintf("<< /Filter /Standard /V 5 /R %d /Length 256 /P -4 "+
+			"/CF << /StdCF << /CFM /AESV3 /Length 32 >> >> /StmF /StdCF /StrF /StdCF "+
+			"/O %s /U %s /OE %s /UE %s >>",
+			revision, hexString(bytes.Repeat([]byte{1}, 48)), hexString(u), hexString(make([]byte, 32)), hexString(ue))
+		return e
+	}
+
+	// algorithm 2 with an empty password
+	o := bytes.Repeat([]byte{0x42}, 32)
+	length := 16
+	if revision == 2 {
+		length = 5
+	}
+	h := md5.New()
+	h.Write(padding)
+	h.Write(o)
+	h.Write([]byte{0xfc, 0xff, 0xff, 0xff})
+	h.Write(testID)
+	key := h.Sum(nil)
+	if revision >= 3 {
+		for i := 0; i < 50; i++ {
+			sum := md5.Sum(key[:length])
+			key = sum[:]
+		}
+	}
+	e.key = key[:length]
+
+	// algorithms 4 and 5
+	var u []byte
+	if revision == 2 {
+		u = testRC4(e.key, padding)
+	} else {
+		sum := md5.Sum(append(append([]byte(nil), padding...), testID...))
+		u = sum[:]
+		for i := 0; i < 20; i++ {
+			k := make([]byte, len(e.key))
+			for j := range k {
+				k[j] = e.key[j] ^ byte(i)
+			}
+			u = testRC4(k, u)
+		}
+		u = append(u, bytes.Repeat([]byte{0x99}, 16)...)
+	}
+
+	switch revision {
+	case 2:
+		e.method = cryptRC4
+		e.dict = fmt.Sprintf("<< /Filter /Standard /V 1 /R 2 /P -4 /O %s /U %s >>", hexString(o), hexString(u))
+	case 3:
+		e.method = cryptRC4
+		e.dict = fmt.Sprintf("<< /Filter /Standard /V 2 /R 3 /Length 128 /P -4 /O %s /U %s >>", hexString(o), hexString(u))
+	case 4:
+		e.method = cryptAES
+		e.dict = fmt.Sprintf("<< /Filter /Standard /V 4 /R 4 /Length 128 /P -4 "+
+			"/CF << /StdCF << /CFM /AESV2 /Length 16 >> >> /StmF /StdCF /StrF /StdCF "+
+			"/O %s /U %s >>", hexString(o), hexString(u))
+	}
+	return e
+}
+
+// encrypt the data of object num, generation 0
+func (e *testEncrypter) encrypt(num int, data []byte) []byte {
+	iv := []byte("an IV of 16 byte")
+	if e.method == cryptAES256 {
+		return testAES(e.key, iv, data, true)
+	}
+	h := md5.New()
+	h.Write(e.key)
+	h.Write([]byte{byte(num), byte(num >> 8), byte(num >> 16), 0, 0})
+	if e.method == cryptAES {
+		h.Write([]byte("sAlT"))
+	}
+	key := h.Sum(nil)
+	if n := len(e.key) + 5; n < 16 {
+		key = key[:n]
+	}
+	if e.method == cryptAES {
+		return testAES(key, iv, data, true)
+	}
+	return testRC4(key, data)
+}
+
+// a one-page file with a cross-reference table and an encrypted page
+func encryptedPDF(e *testEncrypter, contents string) []byte {
+	stream := e.encrypt(4, []byte(contents))
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+		e.dict,
+	}
+
+	var out strings.Builder
+	out.WriteString("%PDF-1.7\n")
+	var offsets []int
+	for i, obj := range objects {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Encrypt 5 0 R /ID [%s %s] >>\nstartxref\n%d\n%%%%EOF\n",
+		len(objects)+1, hexString(testID), hexString(testID), xref)
+	return []byte(out.String())
+}
+
+func TestDecrypt(t *testing.T) {
+	const text = "BT /F1 12 Tf 72 720 Td (Smith, John & Jane) Tj ET"
+	for _, revision := range []int{2, 3, 4, 5, 6} {
+		r, err := NewReader(encryptedPDF(newTestEncrypter(revision), text))
+		if err != nil {
+			t.Errorf("revision %d: %v", revision, err)
+			continue
+		}
+		pages, err := r.Pages()
+		if err != nil || len(pages) != 1 {
+			t.Errorf("revision %d: found %d pages, error %v", revision, len(pages), err)
+			continue
+		}
+		contents, err := r.PageContents(pages[0])
+		if err != nil {
+			t.Errorf("revision %d: %v", revision, err)
+			continue
+		}
+		if got := strings.TrimSpace(string(contents)); got != text {
+			t.Errorf("revision %d: page contents %q, expected %q", revision, got, text)
+		}
+	}
+}
+
+func TestDecryptBadCryptFilter(t *testing.T) {
+	for _, stmf := range []string{"(StdCF)", "42", "7 0 R", "/Missing"} {
+		e := newTestEncrypter(4)
+		e.dict = strings.Replace(e.dict, "/StmF /StdCF", "/StmF "+stmf, 1)
+		if _, err := NewReader(encryptedPDF(e, "BT ET")); err == nil {
+			t.Errorf("StmF %s: expected an error", stmf)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+//
+// PDF stream filters
+// Code to decode the contents of streams read from a PDF file
+//
+
+package pdf
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// decode stream data using a single filter
+func decodeFilter(name Name, data []byte, parms Map) ([]byte, error) {
+	switch name {
+	case "FlateDecode", "Fl":
+		out, err := inflate(data)
+		if err != nil {
+			return nil, err
+		}
+		return unpredict(out, parms)
+
+	case "LZWDecode", "LZW":
+		out, err := unlzw(data, pdfInt(parms["EarlyChange"], 1) != 0)
+		if err != nil {
+			return nil, err
+		}
+		return unpredict(out, parms)
+
+	case "ASCIIHexDecode", "AHx":
+		return unhexStream(data)
+
+	case "ASCII85Decode", "A85":
+		return unascii85(data)
+
+	case "RunLengthDecode", "RL":
+		return unrunlength(data)
+
+	case "DCTDecode", "DCT", "JPXDecode":
+		// images are left in their compressed form
+		return data, nil
+
+	case "Crypt":
+		// only the identity crypt filter is supported,
+		// and decryption happens before filters are applied
+		return data, nil
+
+	default:
+		return nil, fmt.Errorf("Unsupported PDF stream filter: %s", name)
+	}
+}
+
+func inflate(data []byte) ([]byte, error) {
+	var reader io.ReadCloser
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		// some producers leave off the zlib header
+		reader = flate.NewReader(bytes.NewReader(data))
+	}
+	defer reader.Close()
+
+	out, err := ioutil.ReadAll(reader)
+
+	// tolerate truncated streams and bad checksums if we got something
+	if err != nil && len(out) > 0 && (err == io.ErrUnexpectedEOF || err == zlib.ErrChecksum) {
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Uncompressing stream: %v", err)
+	}
+	return out, nil
+}
+
+// undo the predictor (if any) described by the decode parameters
+func unpredict(data []byte, parms Map) ([]byte, error) {
+	predictor := pdfInt(parms["Predictor"], 1)
+	if predictor < 2 {
+		return data, nil
+	}
+	colors := pdfInt(parms["Colors"], 1)
+	bpc := pdfInt(parms["BitsPerComponent"], 8)
+	columns := pdfInt(parms["Columns"], 1)
+
+	// bytes per pixel (at least one) and per row
+	bpp := (colors*bpc + 7) / 8
+	rowlen := (colors*bpc*columns + 7) / 8
+	if rowlen <= 0 {
+		return nil, fmt.Errorf("Invalid predictor parameters")
+	}
+
+	// TIFF predictor 2: each component is a difference from the one to its left
+	if predictor == 2 {
+		if bpc != 8 {
+			return nil, fmt.Errorf("Unsupported TIFF predictor with %d bits per component", bpc)
+		}
+		out := make([]byte, len(data))
+		copy(out, data)
+		for row := 0; row < len(out); row += rowlen {
+			end := row + rowlen
+			if end > len(out) {
+				end = len(out)
+			}
+			for i := row + bpp; i < end; i++ {
+				out[i] += out[i-bpp]
+			}
+		}
+		return out, nil
+	}
+	if predictor < 10 {
+		return nil, fmt.Errorf("Unsupported predictor: %d", predictor)
+	}
+
+	// PNG predictors: each row starts with a byte giving its filter type
+	var out []byte
+	prev := make([]byte, rowlen)
+	for len(data) > 0 {
+		kind := data[0]
+		n := len(data) - 1
+		if n > rowlen {
+			n = rowlen
+		}
+		row := make([]byte, rowlen)
+		copy(row, data[1:1+n])
+		data = data[1+n:]
+
+		switch kind {
+		case 0:
+			// none
+
+		case 1:
+			// sub
+			for i := bpp; i < rowlen; i++ {
+				row[i] += row[i-bpp]
+			}
+
+		case 2:
+			// up
+			for i := range row {
+				row[i] += prev[i]
+			}
+
+		case 3:
+			// average
+			for i := range row {
+				var left int
+				if i >= bpp {
+					left = int(row[i-bpp])
+				}
+				row[i] += byte((left + int(prev[i])) / 2)
+			}
+
+		case 4:
+			// paeth
+			for i := range row {
+				var left, upleft int
+				if i >= bpp {
+					left = int(row[i-bpp])
+					upleft = int(prev[i-bpp])
+				}
+				row[i] += paeth(left, int(prev[i]), upleft)
+			}
+
+		default:
+			return nil, fmt.Errorf("Unknown PNG predictor row type: %d", kind)
+		}
+
+		out = append(out, row[:n]...)
+		prev = row
+	}
+
+	return out, nil
+}
+
+// LZW as used by PDF: 8-bit codes, MSB first, with clear (256) and
+// end of data (257) codes, and code widths from 9 to 12 bits
+func unlzw(data []byte, earlyChange bool) ([]byte, error) {
+	early := 0
+	if earlyChange {
+		early = 1
+	}
+
+	var out []byte
+	var table [][]byte
+	reset := func() {
+		table = make([][]byte, 258, 4096)
+		for i := 0; i < 256; i++ {
+			table[i] = []byte{byte(i)}
+		}
+	}
+	reset()
+
+	var prev []byte
+	width := 9
+	var bits uint32
+	nbits := 0
+	for _, b := range data {
+		bits = bits<<8 | uint32(b)
+		nbits += 8
+		for nbits >= width {
+			code := int(bits>>uint(nbits-width)) & (1<<uint(width) - 1)
+			nbits -= width
+
+			switch {
+			case code == 256:
+				reset()
+				prev = nil
+				width = 9
+				continue
+			case code == 257:
+				return out, nil
+			}
+
+			var entry []byte
+			switch {
+			case code < len(table):
+				entry = table[code]
+			case code == len(table) && prev != nil:
+				entry = append(append([]byte{}, prev...), prev[0])
+			default:
+				return nil, fmt.Errorf("Invalid LZW code: %d", code)
+			}
+			out = append(out, entry...)
+
+			if prev != nil && len(table) < 4096 {
+				next := make([]byte, len(prev)+1)
+				copy(next, prev)
+				next[len(prev)] = entry[0]
+				table = append(table, next)
+			}
+			prev = entry
+
+			// widen the codes as the table grows
+			switch {
+			case len(table)+early >= 2048:
+				width = 12
+			case len(table)+early >= 1024:
+				width = 11
+			case len(table)+early >= 512:
+				width = 10
+			}
+		}
+	}
+
+	// missing end of data marker
+	return out, nil
+}
+
+func unhexStream(data []byte) ([]byte, error) {
+	var out []byte
+	var pending byte
+	odd := false
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		if isPDFSpace(c) {
+			continue
+		}
+		d, ok := unhex(c)
+		if !ok {
+			return nil, fmt.Errorf("Invalid character in ASCIIHexDecode stream: %q", c)
+		}
+		if odd {
+			out = append(out, pending<<4|d)
+		} else {
+			pending = d
+		}
+		odd = !odd
+	}
+	if odd {
+		out = append(out, pending<<4)
+	}
+	return out, nil
+}
+
+func unascii85(data []byte) ([]byte, error) {
+	// skip the optional start of data marker <~
+	data = bytes.TrimPrefix(bytes.TrimLeft(data, "\x00\t\n\f\r "), []byte("<~"))
+
+	var out []byte
+	var group [5]byte
+	n := 0
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case isPDFSpace(c):
+			continue
+		case c == '~':
+			// end of data marker ~>
+			i = len(data)
+			continue
+		case c == 'z' && n == 0:
+			out = append(out, 0, 0, 0, 0)
+			continue
+		case c < '!' || c > 'u':
+			return nil, fmt.Errorf("Invalid character in ASCII85Decode stream: %q", c)
+		}
+		group[n] = c - '!'
+		n++
+		if n == 5 {
+			out = append(out, decode85(group, 5)...)
+			n = 0
+		}
+	}
+
+	// a final partial group is padded with u
+	if n > 0 {
+		for i := n; i < 5; i++ {
+			group[i] = 'u' - '!'
+		}
+		out = append(out, decode85(group, n)...)
+	}
+	return out, nil
+}
+
+func decode85(group [5]byte, n int) []byte {
+	var v uint32
+	for _, d := range group {
+		v = v*85 + uint32(d)
+	}
+	b := []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+	return b[:n-1]
+}
+
+func unrunlength(data []byte) ([]byte, error) {
+	var out []byte
+	for i := 0; i < len(data); {
+		n := int(data[i])
+		i++
+		switch {
+		case n == 128:
+			return out, nil
+		case n < 128:
+			end := i + n + 1
+			if end > len(data) {
+				end = len(data)
+			}
+			out = append(out, data[i:end]...)
+			i = end
+		default:
+			if i >= len(data) {
+				return out, nil
+			}
+			for j := 0; j < 257-n; j++ {
+				out = append(out, data[i])
+			}
+			i++
+		}
+	}
+	return out, nil
+}
+
+func paeth(a, b, c int) byte {
+	p := a + b - c
+	pa, pb, pc := abs(p-a), abs(p-b), abs(p-c)
+	switch {
+	case pa <= pb && pa <= pc:
+		return byte(a)
+	case pb <= pc:
+		return byte(b)
+	default:
+		return byte(c)
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
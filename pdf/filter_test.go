@@ -0,0 +1,22 @@
+package pdf
+
+import (
+	"testing"
+)
+
+func TestUnascii85(t *testing.T) {
+	for _, in := range []string{
+		`87cURD]i,"Ebo80~>`,
+		`<~87cURD]i,"Ebo80~>`,
+		"\n <~87cURD]i,\n\"Ebo80~>",
+	} {
+		out, err := unascii85([]byte(in))
+		if err != nil {
+			t.Errorf("%q: %v", in, err)
+			continue
+		}
+		if string(out) != "Hello World!" {
+			t.Errorf("%q: decoded as %q", in, out)
+		}
+	}
+}
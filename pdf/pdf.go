@@ -0,0 +1,211 @@
+//
+// PDF objects
+// Code to build the objects that make up a PDF file and write
+// them out as a complete document
+//
+
+// Package pdf reads and writes PDF files: the object model, a writer
+// for complete documents, a reader for existing files, and an
+// interpreter for the text in page content streams.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// compress streams when writing them
+const CompressStreams = true
+
+// any object that can be rendered in a PDF file
+type Object interface {
+	Render(indent string, out io.Writer) (err error)
+}
+
+// strings like (this)
+type String string
+
+func (s String) Render(indent string, out io.Writer) (err error) {
+	fmt.Fprintf(out, "(%s)", s)
+	return
+}
+
+// strings like /this
+type Name string
+
+func (s Name) Render(indent string, out io.Writer) (err error) {
+	fmt.Fprintf(out, "/%s", s)
+	return
+}
+
+// indirect object references
+type Ref string
+
+func (s Ref) Render(indent string, out io.Writer) (err error) {
+	fmt.Fprintf(out, "%s", s)
+	return
+}
+
+// any number, float or integer
+type Number float64
+
+func (n Number) Render(indent string, out io.Writer) (err error) {
+	if strings.Contains(fmt.Sprintf("%g", n), "e") {
+		fmt.Fprintf(out, "%f", n)
+	} else {
+		fmt.Fprintf(out, "%g", n)
+	}
+	return
+}
+
+// true or false
+type Bool bool
+
+func (b Bool) Render(indent string, out io.Writer) (err error) {
+	fmt.Fprintf(out, "%t", bool(b))
+	return
+}
+
+// the null object
+type Null struct{}
+
+func (n Null) Render(indent string, out io.Writer) (err error) {
+	fmt.Fprint(out, "null")
+	return
+}
+
+// a list of PDF objects [ like this ]
+type Slice []Object
+
+func (object Slice) Render(indent string, out io.Writer) (err error) {
+	fmt.Fprint(out, "[\n")
+	for _, elt := range object {
+		fmt.Fprintf(out, "%s  ", indent)
+		if err = elt.Render(indent+"  ", out); err != nil {
+			return err
+		}
+		fmt.Fprintln(out)
+	}
+	fmt.Fprintf(out, "%s]", indent)
+	return
+}
+
+// a map of PDF objects << /Like: this >>
+type Map map[string]Object
+
+func (object Map) Render(indent string, out io.Writer) (err error) {
+	fmt.Fprint(out, "<<\n")
+	for key, val := range object {
+		fmt.Fprintf(out, "%s  /%s ", indent, key)
+		if err = val.Render(indent+"  ", out); err != nil {
+			return
+		}
+		fmt.Fprintln(out)
+	}
+	fmt.Fprintf(out, "%s>>", indent)
+	return
+}
+
+// a PDF stream with optional compression
+type Stream struct {
+	Map        Map
+	Data       []byte
+	Compressed []byte
+}
+
+func (stream *Stream) Render(indent string, out io.Writer) (err error) {
+	if CompressStreams && len(stream.Compressed) == 0 {
+		// compress the stream contents
+		var buf bytes.Buffer
+		var writer *zlib.Writer
+		if writer, err = zlib.NewWriterLevel(&buf, zlib.BestCompression); err != nil {
+			return
+		}
+		if _, err = writer.Write(stream.Data); err != nil {
+			return
+		}
+		if err = writer.Close(); err != nil {
+			return
+		}
+		stream.Compressed = buf.Bytes()
+	}
+	if CompressStreams {
+		stream.Map["Filter"] = Name("FlateDecode")
+		stream.Map["Length"] = Number(len(stream.Compressed))
+	} else {
+		stream.Map["Length"] = Number(len(stream.Data))
+	}
+	if err = stream.Map.Render(indent, out); err != nil {
+		return
+	}
+	fmt.Fprint(out, "\nstream\n")
+	if CompressStreams {
+		if _, err = out.Write(stream.Compressed); err != nil {
+			return
+		}
+	} else {
+		if _, err = out.Write(stream.Data); err != nil {
+			return
+		}
+	}
+	fmt.Fprint(out, "endstream")
+	return
+}
+
+// a slice of widths, rendered more compactly than a general slice
+type WidthSlice []int
+
+func (slice WidthSlice) Render(indent string, out io.Writer) (err error) {
+	fmt.Fprint(out, "[")
+	for n, width := range slice {
+		if n%16 == 0 {
+			fmt.Fprintf(out, "\n%s  ", indent)
+		} else {
+			fmt.Fprint(out, " ")
+		}
+		fmt.Fprintf(out, "%d", width)
+	}
+	fmt.Fprintf(out, "\n%s]", indent)
+	return
+}
+
+// a top-level PDF document
+type Document []Object
+
+// add an object to the document and return a reference to it
+func (doc *Document) TopLevelObject(elt Object) (ref Ref) {
+	*doc = append(*doc, elt)
+	return Ref(fmt.Sprintf("%d 0 R", len(*doc)))
+}
+
+// write out the complete file with the given info and catalog objects
+func (doc Document) Render(info, catalog Ref) (pdf []byte, err error) {
+	var out bytes.Buffer
+	var xref []int
+
+	fmt.Fprintf(&out, "%s", "%PDF-1.4\n%«»\n")
+	for i, elt := range doc {
+		xref = append(xref, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n", i+1)
+		if err = elt.Render("", &out); err != nil {
+			return
+		}
+		fmt.Fprint(&out, "\nendobj\n")
+	}
+
+	startxref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(xref)+1)
+	for _, offset := range xref {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprint(&out, "trailer\n<<\n")
+	fmt.Fprintf(&out, "  /Size %d\n", len(xref)+1)
+	fmt.Fprintf(&out, "  /Info %s\n", string(info))
+	fmt.Fprintf(&out, "  /Root %s\n", string(catalog))
+	fmt.Fprintf(&out, ">>\nstartxref\n%d\n%%%%EOF\n", startxref)
+
+	return out.Bytes(), nil
+}
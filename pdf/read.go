@@ -0,0 +1,1050 @@
+//
+// PDF file reader
+// Code to parse the structure of an existing PDF file: the
+// cross-reference table or stream, indirect objects, object streams,
+// and the page tree
+//
+
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// a keyword that is not itself a PDF object,
+// e.g., obj, stream, or a content stream operator like Tj
+type pdfKeyword string
+
+func (k pdfKeyword) Render(indent string, out io.Writer) (err error) {
+	fmt.Fprintf(out, "%s", string(k))
+	return
+}
+
+var errEndOfData = errors.New("Unexpected end of PDF data")
+
+// a lexer/parser for PDF object syntax
+// strings and names are stored in decoded form, so objects read
+// from a file should not be rendered back out unchanged
+type pdfParser struct {
+	data []byte
+	pos  int
+}
+
+func isPDFSpace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func isPDFRegular(c byte) bool {
+	return !isPDFSpace(c) && !isPDFDelimiter(c)
+}
+
+// skip whitespace and comments
+func (p *pdfParser) skipSpace() {
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		switch {
+		case c == '%':
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' && p.data[p.pos] != '\r' {
+				p.pos++
+			}
+		case isPDFSpace(c):
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// read a run of regular characters
+func (p *pdfParser) regular() string {
+	start := p.pos
+	for p.pos < len(p.data) && isPDFRegular(p.data[p.pos]) {
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+func looksNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9') && c != '.' && c != '-' && c != '+' {
+			return false
+		}
+	}
+	return true
+}
+
+func looksInteger(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// parse the next object
+// anything that is not an object is returned as a pdfKeyword,
+// including the closing ] and >> delimiters
+func (p *pdfParser) next() (Object, error) {
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return nil, io.EOF
+	}
+
+	c := p.data[p.pos]
+	switch {
+	case c == '/':
+		return p.name(), nil
+
+	case c == '(':
+		return p.literalString()
+
+	case c == '<' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '<':
+		p.pos += 2
+		return p.dict()
+
+	case c == '<':
+		return p.hexString()
+
+	case c == '[':
+		p.pos++
+		return p.array()
+
+	case c == '>' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '>':
+		p.pos += 2
+		return pdfKeyword(">>"), nil
+
+	case isPDFDelimiter(c):
+		// ], {, }, and stray delimiters
+		p.pos++
+		return pdfKeyword(string(c)), nil
+	}
+
+	tok := p.regular()
+	switch tok {
+	case "true":
+		return Bool(true), nil
+	case "false":
+		return Bool(false), nil
+	case "null":
+		return Null{}, nil
+	}
+	if !looksNumeric(tok) {
+		return pdfKeyword(tok), nil
+	}
+	n, err := strconv.ParseFloat(tok, 64)
+	if err != nil {
+		// malformed numbers are treated as zero
+		return Number(0), nil
+	}
+
+	// could this be the start of an indirect reference: num gen R
+	if looksInteger(tok) {
+		save := p.pos
+		p.skipSpace()
+		gen := p.regular()
+		p.skipSpace()
+		if looksInteger(gen) && p.pos < len(p.data) && p.data[p.pos] == 'R' &&
+			(p.pos+1 == len(p.data) || !isPDFRegular(p.data[p.pos+1])) {
+			p.pos++
+			return Ref(tok + " " + gen + " R"), nil
+		}
+		p.pos = save
+	}
+
+	return Number(n), nil
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// a name like /Type with #xx escapes decoded
+func (p *pdfParser) name() Name {
+	p.pos++
+	raw := p.regular()
+	var out []byte
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && i+2 < len(raw) {
+			hi, ok1 := unhex(raw[i+1])
+			lo, ok2 := unhex(raw[i+2])
+			if ok1 && ok2 {
+				out = append(out, hi<<4|lo)
+				i += 2
+				continue
+			}
+		}
+		out = append(out, raw[i])
+	}
+	return Name(out)
+}
+
+// a string like (this), with escape sequences decoded
+func (p *pdfParser) literalString() (Object, error) {
+	p.pos++
+	var out []byte
+	depth := 1
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+		switch c {
+		case '(':
+			depth++
+			out = append(out, c)
+
+		case ')':
+			depth--
+			if depth == 0 {
+				return String(out), nil
+			}
+			out = append(out, c)
+
+		case '\r':
+			// end of line markers are always read as \n
+			if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+				p.pos++
+			}
+			out = append(out, '\n')
+
+		case '\\':
+			if p.pos >= len(p.data) {
+				break
+			}
+			c = p.data[p.pos]
+			p.pos++
+			switch c {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				// line continuation
+				if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+					p.pos++
+				}
+			case '\n':
+				// line continuation
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				// up to three octal digits
+				code := int(c - '0')
+				for i := 0; i < 2 && p.pos < len(p.data); i++ {
+					d := p.data[p.pos]
+					if d < '0' || d > '7' {
+						break
+					}
+					code = code*8 + int(d-'0')
+					p.pos++
+				}
+				out = append(out, byte(code))
+			default:
+				// \(, \), \\, and unknown escapes are the character itself
+				out = append(out, c)
+			}
+
+		default:
+			out = append(out, c)
+		}
+	}
+	return nil, errEndOfData
+}
+
+// a string like <48656c6c6f>
+func (p *pdfParser) hexString() (Object, error) {
+	p.pos++
+	var out []byte
+	var pending byte
+	odd := false
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+		if c == '>' {
+			if odd {
+				out = append(out, pending<<4)
+			}
+			return String(out), nil
+		}
+		d, ok := unhex(c)
+		if !ok {
+			// skip whitespace and junk
+			continue
+		}
+		if odd {
+			out = append(out, pending<<4|d)
+		} else {
+			pending = d
+		}
+		odd = !odd
+	}
+	return nil, errEndOfData
+}
+
+func (p *pdfParser) array() (Object, error) {
+	var lst Slice
+	for {
+		elt, err := p.next()
+		if err == io.EOF {
+			return nil, errEndOfData
+		} else if err != nil {
+			return nil, err
+		}
+		if elt == pdfKeyword("]") {
+			return lst, nil
+		}
+		lst = append(lst, elt)
+	}
+}
+
+func (p *pdfParser) dict() (Object, error) {
+	m := Map{}
+	for {
+		key, err := p.next()
+		if err == io.EOF {
+			return nil, errEndOfData
+		} else if err != nil {
+			return nil, err
+		}
+		if key == pdfKeyword(">>") {
+			return m, nil
+		}
+		name, ok := key.(Name)
+		if !ok {
+			// ignore junk where a key should be
+			continue
+		}
+
+		val, err := p.next()
+		if err == io.EOF {
+			return nil, errEndOfData
+		} else if err != nil {
+			return nil, err
+		}
+		if val == pdfKeyword(">>") {
+			// a key with no value
+			return m, nil
+		}
+
+		// a null value is the same as a missing entry
+		if _, isNull := val.(Null); !isNull {
+			m[string(name)] = val
+		}
+	}
+}
+
+// where to find an indirect object
+type xrefEntry struct {
+	free       bool
+	offset     int // byte offset of the object, or object stream number
+	index      int // index within the object stream
+	compressed bool
+}
+
+// a decoded object stream
+type objectStream struct {
+	data    []byte
+	offsets map[int]int
+}
+
+// a PDF file opened for reading
+type Reader struct {
+	data    []byte
+	xref    map[int]*xrefEntry
+	trailer Map
+	objects map[int]Object
+	objstms map[int]*objectStream
+	loading map[int]bool
+
+	// set if the file is encrypted
+	crypt      *pdfDecrypter
+	encryptNum int
+}
+
+// a single page with its inherited resources
+type Page struct {
+	Number    int
+	Dict      Map
+	Resources Map
+}
+
+// open a PDF file, decrypting it if necessary
+func NewReader(data []byte) (r *Reader, err error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\n\f\r "), []byte("%PDF-")) {
+		return nil, errors.New("Not a PDF file")
+	}
+	r = &Reader{
+		data:    data,
+		xref:    make(map[int]*xrefEntry),
+		objects: make(map[int]Object),
+		objstms: make(map[int]*objectStream),
+		loading: make(map[int]bool),
+	}
+
+	// read the cross-reference data, falling back to scanning the
+	// whole file if it is missing or damaged
+	if err = r.readXref(); err != nil || r.catalog() == nil {
+		if err = r.rebuildXref(); err != nil {
+			return nil, err
+		}
+	}
+	if r.catalog() == nil {
+		return nil, errors.New("PDF file has no document catalog")
+	}
+
+	return r, nil
+}
+
+// parse an integer: a direct number, or the fallback value
+func pdfInt(obj Object, fallback int) int {
+	if n, ok := obj.(Number); ok {
+		return int(n)
+	}
+	return fallback
+}
+
+// parse an indirect reference of the form "12 0 R"
+func refNumber(ref Ref) int {
+	n := 0
+	for _, c := range []byte(ref) {
+		if c < '0' || c > '9' {
+			break
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n
+}
+
+// follow indirect references until reaching a direct object
+func (r *Reader) Resolve(obj Object) (Object, error) {
+	for i := 0; i < 32; i++ {
+		ref, isRef := obj.(Ref)
+		if !isRef {
+			return obj, nil
+		}
+		var err error
+		if obj, err = r.Object(refNumber(ref)); err != nil {
+			return nil, err
+		}
+	}
+	return nil, errors.New("Too many levels of indirect references")
+}
+
+// resolve an object, treating any error as a missing object
+func (r *Reader) Lookup(obj Object) Object {
+	elt, err := r.Resolve(obj)
+	if err != nil {
+		return nil
+	}
+	return elt
+}
+
+// resolve an object that should be a dictionary
+// the dictionary of a stream is also accepted
+func (r *Reader) LookupMap(obj Object) Map {
+	switch elt := r.Lookup(obj).(type) {
+	case Map:
+		return elt
+	case *Stream:
+		return elt.Map
+	}
+	return nil
+}
+
+func (r *Reader) catalog() Map {
+	if r.trailer == nil {
+		return nil
+	}
+	return r.LookupMap(r.trailer["Root"])
+}
+
+// load an indirect object by number
+func (r *Reader) Object(num int) (obj Object, err error) {
+	if obj, present := r.objects[num]; present {
+		return obj, nil
+	}
+	entry, present := r.xref[num]
+	if !present || entry.free {
+		// references to missing objects are treated as null
+		return Null{}, nil
+	}
+	if r.loading[num] {
+		return nil, fmt.Errorf("Circular reference to PDF object %d", num)
+	}
+	r.loading[num] = true
+	defer delete(r.loading, num)
+
+	// objects inside object streams are not encrypted separately
+	if entry.compressed {
+		obj, err = r.compressedObject(entry.offset, entry.index, num)
+	} else {
+		var gen int
+		_, gen, obj, err = r.objectAt(entry.offset)
+		if err == nil && r.crypt != nil && num != r.encryptNum {
+			obj, err = r.crypt.decryptObject(obj, num, gen)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Reading PDF object %d: %v", num, err)
+	}
+
+	r.objects[num] = obj
+	return obj, nil
+}
+
+// parse an object of the form "num gen obj ... endobj" at a byte offset
+func (r *Reader) objectAt(offset int) (num, gen int, obj Object, err error) {
+	if offset < 0 || offset >= len(r.data) {
+		return 0, 0, nil, fmt.Errorf("Object offset %d is out of range", offset)
+	}
+	p := &pdfParser{data: r.data, pos: offset}
+	header := make([]Object, 3)
+	for i := range header {
+		if header[i], err = p.next(); err != nil {
+			return 0, 0, nil, err
+		}
+	}
+	n, ok1 := header[0].(Number)
+	g, ok2 := header[1].(Number)
+	if !ok1 || !ok2 || header[2] != pdfKeyword("obj") {
+		return 0, 0, nil, fmt.Errorf("No object found at offset %d", offset)
+	}
+	num, gen = int(n), int(g)
+
+	if obj, err = p.next(); err != nil {
+		return 0, 0, nil, err
+	}
+
+	// is this the dictionary of a stream?
+	if m, isMap := obj.(Map); isMap {
+		save := p.pos
+		if kw, err := p.next(); err == nil && kw == pdfKeyword("stream") {
+			return num, gen, &Stream{Map: m, Data: r.rawStream(p.pos, m)}, nil
+		}
+		p.pos = save
+	}
+
+	return num, gen, obj, nil
+}
+
+// find the raw bytes of a stream, which begin just after the stream keyword
+func (r *Reader) rawStream(start int, m Map) []byte {
+	// the keyword is followed by CRLF or LF (or a lone CR in broken files)
+	if start < len(r.data) && r.data[start] == '\r' {
+		start++
+	}
+	if start < len(r.data) && r.data[start] == '\n' {
+		start++
+	}
+
+	// trust the length if it is followed by endstream
+	length := pdfInt(r.Lookup(m["Length"]), -1)
+	if length >= 0 && start+length <= len(r.data) {
+		p := &pdfParser{data: r.data, pos: start + length}
+		if kw, err := p.next(); err == nil && kw == pdfKeyword("endstream") {
+			return r.data[start : start+length]
+		}
+	}
+
+	// otherwise search for the end of the stream
+	end := bytes.Index(r.data[start:], []byte("endstream"))
+	if end < 0 {
+		return r.data[start:]
+	}
+	data := r.data[start : start+end]
+	if bytes.HasSuffix(data, []byte("\r\n")) {
+		data = data[:len(data)-2]
+	} else if bytes.HasSuffix(data, []byte("\n")) || bytes.HasSuffix(data, []byte("\r")) {
+		data = data[:len(data)-1]
+	}
+	return data
+}
+
+// load an object stored inside an object stream
+func (r *Reader) compressedObject(stmnum, index, num int) (Object, error) {
+	stm, err := r.objectStream(stmnum)
+	if err != nil {
+		return nil, err
+	}
+	offset, present := stm.offsets[num]
+	if !present {
+		return nil, fmt.Errorf("Object %d (index %d) not found in object stream %d", num, index, stmnum)
+	}
+	p := &pdfParser{data: stm.data, pos: offset}
+	return p.next()
+}
+
+func (r *Reader) objectStream(num int) (*objectStream, error) {
+	if stm, present := r.objstms[num]; present {
+		return stm, nil
+	}
+	obj, err := r.Object(num)
+	if err != nil {
+		return nil, err
+	}
+	stream, isStream := obj.(*Stream)
+	if !isStream {
+		return nil, fmt.Errorf("Object %d is not an object stream", num)
+	}
+	data, err := r.StreamData(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	// the header is a list of pairs: object number, offset
+	count := pdfInt(stream.Map["N"], 0)
+	first := pdfInt(stream.Map["First"], 0)
+	if first < 0 || first > len(data) {
+		return nil, fmt.Errorf("Malformed object stream %d", num)
+	}
+	stm := &objectStream{data: data, offsets: make(map[int]int)}
+	p := &pdfParser{data: data[:first]}
+	for i := 0; i < count; i++ {
+		a, err1 := p.next()
+		b, err2 := p.next()
+		objnum, ok1 := a.(Number)
+		offset, ok2 := b.(Number)
+		if err1 != nil || err2 != nil || !ok1 || !ok2 {
+			break
+		}
+		if offset < 0 || first+int(offset) >= len(data) {
+			return nil, fmt.Errorf("Malformed object stream %d: offset %d is out of range", num, int(offset))
+		}
+		stm.offsets[int(objnum)] = first + int(offset)
+	}
+
+	r.objstms[num] = stm
+	return stm, nil
+}
+
+// merge a trailer dictionary; newer sections are read first and take precedence
+func (r *Reader) mergeTrailer(m Map) {
+	if r.trailer == nil {
+		r.trailer = Map{}
+	}
+	for key, val := range m {
+		if _, present := r.trailer[key]; !present {
+			r.trailer[key] = val
+		}
+	}
+}
+
+// follow the chain of cross-reference sections starting at startxref
+func (r *Reader) readXref() error {
+	at := bytes.LastIndex(r.data, []byte("startxref"))
+	if at < 0 {
+		return errors.New("No startxref found")
+	}
+	p := &pdfParser{data: r.data, pos: at + len("startxref")}
+	obj, err := p.next()
+	if err != nil {
+		return err
+	}
+	offset := pdfInt(obj, -1)
+
+	seen := make(map[int]bool)
+	for offset >= 0 && !seen[offset] {
+		seen[offset] = true
+		if offset, err = r.readXrefSection(offset); err != nil {
+			return err
+		}
+	}
+	return r.setupEncryption()
+}
+
+// if the file is encrypted, prepare to decrypt objects as they are loaded
+func (r *Reader) setupEncryption() error {
+	if r.crypt != nil || r.trailer == nil || r.trailer["Encrypt"] == nil {
+		return nil
+	}
+	encrypt := r.LookupMap(r.trailer["Encrypt"])
+	if encrypt == nil {
+		return errors.New("PDF encryption dictionary not found")
+	}
+	if ref, isRef := r.trailer["Encrypt"].(Ref); isRef {
+		r.encryptNum = refNumber(ref)
+	} else {
+		r.encryptNum = -1
+	}
+	var id []byte
+	if lst, isSlice := r.Lookup(r.trailer["ID"]).(Slice); isSlice && len(lst) > 0 {
+		s, _ := r.Lookup(lst[0]).(String)
+		id = []byte(s)
+	}
+	crypt, err := newDecrypter(encrypt, id)
+	if err != nil {
+		return err
+	}
+	r.crypt = crypt
+
+	// anything loaded so far was not decrypted
+	r.objects = make(map[int]Object)
+	r.objstms = make(map[int]*objectStream)
+	return nil
+}
+
+// read one cross-reference section: either a classic table or a stream
+// returns the offset of the previous section, or -1
+func (r *Reader) readXrefSection(offset int) (prev int, err error) {
+	if offset >= len(r.data) {
+		return -1, fmt.Errorf("Cross-reference offset %d is out of range", offset)
+	}
+	p := &pdfParser{data: r.data, pos: offset}
+	p.skipSpace()
+	if !bytes.HasPrefix(r.data[p.pos:], []byte("xref")) {
+		// it should be a cross-reference stream
+		_, _, obj, err := r.objectAt(offset)
+		if err != nil {
+			return -1, err
+		}
+		stream, isStream := obj.(*Stream)
+		if !isStream || stream.Map["Type"] != Name("XRef") {
+			return -1, fmt.Errorf("No cross-reference data found at offset %d", offset)
+		}
+		if err = r.readXrefStream(stream); err != nil {
+			return -1, err
+		}
+		r.mergeTrailer(stream.Map)
+		return pdfInt(stream.Map["Prev"], -1), nil
+	}
+	p.pos += len("xref")
+
+	// read the subsections
+	for {
+		obj, err := p.next()
+		if err != nil {
+			return -1, err
+		}
+		if obj == pdfKeyword("trailer") {
+			break
+		}
+		start, ok1 := obj.(Number)
+		obj, err = p.next()
+		count, ok2 := obj.(Number)
+		if err != nil || !ok1 || !ok2 {
+			return -1, errors.New("Malformed cross-reference table")
+		}
+		for i := 0; i < int(count); i++ {
+			a, err1 := p.next()
+			_, err2 := p.next()
+			kind, err3 := p.next()
+			if err1 != nil || err2 != nil || err3 != nil {
+				return -1, errors.New("Malformed cross-reference table entry")
+			}
+			num := int(start) + i
+			if _, present := r.xref[num]; present {
+				continue
+			}
+			r.xref[num] = &xrefEntry{
+				free:   kind != pdfKeyword("n"),
+				offset: pdfInt(a, 0),
+			}
+		}
+	}
+
+	obj, err := p.next()
+	if err != nil {
+		return -1, err
+	}
+	trailer, isMap := obj.(Map)
+	if !isMap {
+		return -1, errors.New("Malformed trailer dictionary")
+	}
+
+	// hybrid files have a cross-reference stream as well
+	if stm := pdfInt(trailer["XRefStm"], -1); stm >= 0 {
+		if _, _, obj, err := r.objectAt(stm); err == nil {
+			if stream, isStream := obj.(*Stream); isStream {
+				if err = r.readXrefStream(stream); err != nil {
+					return -1, err
+				}
+			}
+		}
+	}
+
+	r.mergeTrailer(trailer)
+	return pdfInt(trailer["Prev"], -1), nil
+}
+
+// the widest field allowed in a cross-reference stream entry, in bytes
+const MaxXrefFieldWidth = 8
+
+func (r *Reader) readXrefStream(stream *Stream) error {
+	data, err := r.StreamData(stream)
+	if err != nil {
+		return err
+	}
+
+	// the widths of the fields in each entry
+	w, _ := stream.Map["W"].(Slice)
+	if len(w) != 3 {
+		return errors.New("Malformed cross-reference stream")
+	}
+	widths := []int{pdfInt(w[0], 0), pdfInt(w[1], 0), pdfInt(w[2], 0)}
+	for _, width := range widths {
+		// each field must fit in an int
+		if width < 0 || width > MaxXrefFieldWidth {
+			return fmt.Errorf("Malformed cross-reference stream: field width %d", width)
+		}
+	}
+	rowlen := widths[0] + widths[1] + widths[2]
+	if rowlen == 0 {
+		return errors.New("Malformed cross-reference stream")
+	}
+
+	// which object numbers are included
+	index, _ := stream.Map["Index"].(Slice)
+	if len(index) == 0 {
+		index = Slice{Number(0), stream.Map["Size"]}
+	}
+
+	for i := 0; i+1 < len(index); i += 2 {
+		start, count := pdfInt(index[i], 0), pdfInt(index[i+1], 0)
+		for j := 0; j < count && len(data) >= rowlen; j++ {
+			var fields [3]int
+			for k, width := range widths {
+				for _, b := range data[:width] {
+					fields[k] = fields[k]<<8 | int(b)
+				}
+				data = data[width:]
+			}
+
+			// the type defaults to 1 if its field is missing
+			if widths[0] == 0 {
+				fields[0] = 1
+			}
+
+			num := start + j
+			if _, present := r.xref[num]; present {
+				continue
+			}
+			switch fields[0] {
+			case 0:
+				r.xref[num] = &xrefEntry{free: true}
+			case 1:
+				r.xref[num] = &xrefEntry{offset: fields[1]}
+			case 2:
+				r.xref[num] = &xrefEntry{offset: fields[1], index: fields[2], compressed: true}
+			}
+		}
+	}
+
+	return nil
+}
+
+var objectHeader = regexp.MustCompile(`(\d+)[\x00\t\n\f\r ]+\d+[\x00\t\n\f\r ]+obj\b`)
+
+// rebuild the cross-reference data by scanning the whole file
+// for object headers and trailers
+func (r *Reader) rebuildXref() error {
+	r.xref = make(map[int]*xrefEntry)
+	r.trailer = nil
+	r.objects = make(map[int]Object)
+	r.objstms = make(map[int]*objectStream)
+	r.crypt = nil
+
+	// later definitions replace earlier ones
+	for _, loc := range objectHeader.FindAllSubmatchIndex(r.data, -1) {
+		if loc[0] > 0 && isPDFRegular(r.data[loc[0]-1]) {
+			continue
+		}
+		num, err := strconv.Atoi(string(r.data[loc[2]:loc[3]]))
+		if err != nil {
+			continue
+		}
+		r.xref[num] = &xrefEntry{offset: loc[0]}
+	}
+	if len(r.xref) == 0 {
+		return errors.New("No objects found in PDF file")
+	}
+
+	// use the trailers, newest first
+	trailers := bytes.Split(r.data, []byte("trailer"))
+	for i := len(trailers) - 1; i > 0; i-- {
+		p := &pdfParser{data: trailers[i]}
+		if obj, err := p.next(); err == nil {
+			if m, isMap := obj.(Map); isMap {
+				r.mergeTrailer(m)
+			}
+		}
+	}
+	if err := r.setupEncryption(); err != nil {
+		return err
+	}
+
+	// include objects from object streams and look for the catalog
+	var nums []int
+	for num := range r.xref {
+		nums = append(nums, num)
+	}
+	for _, num := range nums {
+		obj, err := r.Object(num)
+		if err != nil {
+			continue
+		}
+		m := r.LookupMap(obj)
+		switch m["Type"] {
+		case Name("ObjStm"):
+			stm, err := r.objectStream(num)
+			if err != nil {
+				continue
+			}
+			for elt := range stm.offsets {
+				if _, present := r.xref[elt]; !present {
+					r.xref[elt] = &xrefEntry{offset: num, compressed: true}
+				}
+			}
+		case Name("XRef"):
+			r.mergeTrailer(Map{"Root": m["Root"], "Info": m["Info"], "Encrypt": m["Encrypt"], "ID": m["ID"]})
+		}
+	}
+	if r.catalog() == nil {
+		for num := range r.xref {
+			ref := Ref(fmt.Sprintf("%d 0 R", num))
+			if r.LookupMap(ref)["Type"] == Name("Catalog") {
+				r.mergeTrailer(Map{"Root": ref})
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// walk the page tree and return the pages in order
+func (r *Reader) Pages() (pages []*Page, err error) {
+	root := r.catalog()
+	if root == nil {
+		return nil, errors.New("PDF file has no document catalog")
+	}
+	visited := make(map[Ref]bool)
+	if err = r.walkPages(root["Pages"], nil, visited, &pages); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+func (r *Reader) walkPages(node Object, resources Map, visited map[Ref]bool, pages *[]*Page) error {
+	if ref, isRef := node.(Ref); isRef {
+		if visited[ref] {
+			return fmt.Errorf("Loop in PDF page tree at %s", ref)
+		}
+		visited[ref] = true
+	}
+	dict := r.LookupMap(node)
+	if dict == nil {
+		return errors.New("Malformed PDF page tree")
+	}
+
+	// resources are inherited from ancestors in the tree
+	if res := r.LookupMap(dict["Resources"]); res != nil {
+		resources = res
+	}
+
+	kids, hasKids := r.Lookup(dict["Kids"]).(Slice)
+	if dict["Type"] == Name("Pages") || (dict["Type"] != Name("Page") && hasKids) {
+		for _, kid := range kids {
+			if err := r.walkPages(kid, resources, visited, pages); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	*pages = append(*pages, &Page{
+		Number:    len(*pages) + 1,
+		Dict:      dict,
+		Resources: resources,
+	})
+	return nil
+}
+
+// get the decoded content stream(s) of a page
+func (r *Reader) PageContents(page *Page) (contents []byte, err error) {
+	var streams []Object
+	switch elt := r.Lookup(page.Dict["Contents"]).(type) {
+	case *Stream:
+		streams = append(streams, elt)
+	case Slice:
+		streams = elt
+	}
+
+	for _, elt := range streams {
+		stream, isStream := r.Lookup(elt).(*Stream)
+		if !isStream {
+			continue
+		}
+		data, err := r.StreamData(stream)
+		if err != nil {
+			return nil, err
+		}
+
+		// separate the streams so tokens are not joined
+		contents = append(contents, data...)
+		contents = append(contents, '\n')
+	}
+	return contents, nil
+}
+
+// get the decoded contents of a stream
+func (r *Reader) StreamData(stream *Stream) ([]byte, error) {
+	var filters []Object
+	var parms []Object
+	switch elt := r.Lookup(stream.Map["Filter"]).(type) {
+	case Name:
+		filters = Slice{elt}
+		parms = Slice{stream.Map["DecodeParms"]}
+	case Slice:
+		filters = elt
+		parms, _ = r.Lookup(stream.Map["DecodeParms"]).(Slice)
+	}
+
+	data := stream.Data
+	for i, filter := range filters {
+		name, _ := r.Lookup(filter).(Name)
+		var parm Map
+		if i < len(parms) {
+			parm = r.LookupMap(parms[i])
+		}
+		var err error
+		if data, err = decodeFilter(name, data, parm); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,84 @@
+package pdf
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// assemble a PDF file from numbered objects (starting at 1), with
+// startxref pointing at object xrefNum
+func buildPDF(objects []string, xrefNum int) []byte {
+	var out strings.Builder
+	out.WriteString("%PDF-1.5\n")
+	xrefAt := 0
+	for i, obj := range objects {
+		if i+1 == xrefNum {
+			xrefAt = out.Len()
+		}
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	fmt.Fprintf(&out, "startxref\n%d\n%%%%EOF\n", xrefAt)
+	return []byte(out.String())
+}
+
+func xrefStream(dict, data string) string {
+	return fmt.Sprintf("<< /Type /XRef %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func TestXrefStreamBadWidths(t *testing.T) {
+	for _, w := range []string{"[-1 2 1]", "[1 -2 1]", "[1 9 1]", "[1 2 100000]"} {
+		data := buildPDF([]string{
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [] /Count 0 >>",
+			xrefStream("/W "+w+" /Size 4 /Root 1 0 R", "\x01\x00\x0f\x00\x01\x00\x30\x00"),
+		}, 3)
+
+		// the cross-reference data is rebuilt by scanning the file
+		r, err := NewReader(data)
+		if err != nil {
+			t.Errorf("W %s: %v", w, err)
+			continue
+		}
+		if pages, err := r.Pages(); err != nil || len(pages) != 0 {
+			t.Errorf("W %s: found %d pages, error %v", w, len(pages), err)
+		}
+	}
+}
+
+func TestObjectStreamBadOffsets(t *testing.T) {
+	for _, header := range []string{"5 -30 ", "5 9999 "} {
+		stream := header + "<< /Type /Catalog /Pages 2 0 R >>"
+		objstm := fmt.Sprintf("<< /Type /ObjStm /N 1 /First %d /Length %d >>\nstream\n%s\nendstream",
+			len(header), len(stream), stream)
+
+		// objects 0-4 are free or in the file, 5 is in the object stream
+		rows := "\x00\x00\x00" + "\x01\x00\x00" + "\x01\x00\x00" + "\x01\x00\x00" + "\x01\x00\x00" + "\x02\x04\x00"
+		data := buildPDF([]string{
+			"<< >>",
+			"<< /Type /Pages /Kids [] /Count 0 >>",
+			xrefStream("/W [1 1 1] /Size 6 /Root 5 0 R", rows),
+			objstm,
+		}, 3)
+
+		// the catalog cannot be found, but that is an error, not a panic
+		if _, err := NewReader(data); err == nil {
+			t.Errorf("header %q: expected an error", header)
+		}
+	}
+
+	// the object stream is fine when the offsets are
+	header := "5 0 "
+	stream := header + "<< /Type /Catalog /Pages 2 0 R >>"
+	objstm := fmt.Sprintf("<< /Type /ObjStm /N 1 /First %d /Length %d >>\nstream\n%s\nendstream",
+		len(header), len(stream), stream)
+	data := buildPDF([]string{
+		"<< >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+		xrefStream("/W [1 1 1] /Size 6 /Root 5 0 R", strings.Repeat("\x00", 15)+"\x02\x04\x00"),
+		objstm,
+	}, 3)
+	if _, err := NewReader(data); err != nil {
+		t.Errorf("valid object stream: %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+//
+// Household photos
+// Code to export the household photos as a zip file of JPEG images
+//
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var unsafeFilename = regexp.MustCompile(`[^\pL\pN\-_.,&' ]+`)
+
+// a zip file with one JPEG for each family that has a photo,
+// named by surname and couple
+func (dir *Directory) ExportPhotos() ([]byte, error) {
+	dir.ApplyPrivacy()
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	used := make(map[string]bool)
+	for _, family := range dir.Families {
+		if len(family.Photo) == 0 {
+			continue
+		}
+		base := family.Surname
+		if family.Couple != "" {
+			base += " - " + family.Couple
+		}
+		base = strings.TrimSpace(unsafeFilename.ReplaceAllString(base, "_"))
+		name := base + ".jpg"
+		for n := 2; used[strings.ToLower(name)]; n++ {
+			name = fmt.Sprintf("%s (%d).jpg", base, n)
+		}
+		used[strings.ToLower(name)] = true
+
+		fp, err := archive.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = fp.Write(family.Photo); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,88 @@
+//
+// Household preparation
+// Code to apply the settings to the households before they are laid out
+//
+
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/russross/warddirectory/cleanup"
+	"github.com/russross/warddirectory/membership"
+)
+
+func (dir *Directory) PrepareFamilies() error {
+	// leave out what households asked not to publish
+	dir.ApplyPrivacy()
+
+	// clean up entries details
+	for _, f := range dir.Families {
+		if dir.FamilyAddress {
+			f.Address = cleanup.PrepAddress(dir.AddressRegexps, f.Address)
+		} else {
+			f.Address = nil
+		}
+
+		if dir.FamilyPhone {
+			f.Phone = cleanup.PrepPhone(dir.PhoneRegexps, f.Phone, "")
+		} else {
+			f.Phone = ""
+		}
+
+		if dir.FamilyEmail {
+			f.Email = cleanup.PrepEmail(f.Email, "")
+		} else {
+			f.Email = ""
+		}
+
+		for _, p := range f.People {
+			p.Name = cleanup.PrepName(dir.NameRegexps, p.Name)
+
+			// only show surname if different from family name
+			if strings.HasPrefix(strings.ToLower(p.Name), strings.ToLower(f.Surname)+", ") {
+				p.Name = p.Name[len(f.Surname)+2:]
+
+				// rearrange as "first last"
+				// note: if last name has already been removed, we
+				// assume this is "bob, jr" or the like and leave it alone, hence else if
+			} else if comma := strings.Index(p.Name, ", "); comma >= 0 {
+				p.Name = p.Name[comma+2:] + " " + p.Name[:comma]
+			}
+
+			if dir.PersonalPhones {
+				p.Phone = cleanup.PrepPhone(dir.PhoneRegexps, p.Phone, f.Phone)
+			} else {
+				p.Phone = ""
+			}
+
+			if dir.PersonalEmails {
+				p.Email = cleanup.PrepEmail(p.Email, f.Email)
+			} else {
+				p.Email = ""
+			}
+		}
+	}
+
+	sort.Sort(familyList(dir.Families))
+	return nil
+}
+
+// sortable list
+type familyList []*membership.Family
+
+func (lst familyList) Len() int {
+	return len(lst)
+}
+
+func (lst familyList) Less(i, j int) bool {
+	if lst[i].Surname != lst[j].Surname {
+		return lst[i].Surname < lst[j].Surname
+	}
+	return lst[i].Couple < lst[j].Couple
+}
+
+func (lst familyList) Swap(i, j int) {
+	lst[i], lst[j] = lst[j], lst[i]
+}
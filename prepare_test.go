@@ -0,0 +1,33 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/russross/warddirectory/membership"
+)
+
+func TestFamilyOrder(t *testing.T) {
+	var families []*membership.Family
+	for _, elt := range []string{
+		"Smith|Smith, Zed", "Jones|Jones, Bob", "Smith|Smith, Amy & Smith, Tom",
+		"Adams|Adams, Sue", "Smith|Smith, John & Smith, Jane", "Jones|Jones, Ann",
+	} {
+		parts := strings.Split(elt, "|")
+		families = append(families, &membership.Family{Surname: parts[0], Couple: parts[1]})
+	}
+	sort.Sort(familyList(families))
+
+	var order []string
+	for _, family := range families {
+		order = append(order, family.Couple)
+	}
+	expected := []string{
+		"Adams, Sue", "Jones, Ann", "Jones, Bob",
+		"Smith, Amy & Smith, Tom", "Smith, John & Smith, Jane", "Smith, Zed",
+	}
+	if strings.Join(order, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("families are in the order %q, expected %q", order, expected)
+	}
+}
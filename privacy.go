@@ -0,0 +1,136 @@
+//
+// Privacy preferences
+// Code to leave out the details that a household or person asked
+// not to publish, on top of the directory-wide choices
+//
+
+package main
+
+import (
+	"strings"
+
+	"github.com/russross/warddirectory/membership"
+)
+
+// what one household, or one person in it, wants left out
+// the household is found by surname plus couple, or surname plus address
+// if Person is blank, the preference covers the whole household
+type PrivacyPreference struct {
+	Surname string
+	Couple  string
+	Address string
+	Person  string
+
+	HideAddress bool
+	HidePhone   bool
+	HideEmail   bool
+	HidePhoto   bool
+	Omit        bool
+}
+
+// does the preference apply to this family?
+func (pref *PrivacyPreference) Matches(family *membership.Family) bool {
+	var address []string
+	if pref.Address != "" {
+		address = []string{pref.Address}
+	}
+	keys := membership.FamilyKeys(&membership.Family{Surname: pref.Surname, Couple: pref.Couple, Address: address})
+	for _, key := range membership.FamilyKeys(family) {
+		for _, elt := range keys {
+			if key == elt {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// drop preferences that do not name a household
+func (dir *Directory) CleanPrivacy() {
+	var kept []*PrivacyPreference
+	for _, pref := range dir.Privacy {
+		if pref != nil && strings.TrimSpace(pref.Surname) != "" && (pref.Couple != "" || pref.Address != "") {
+			kept = append(kept, pref)
+		}
+	}
+	dir.Privacy = kept
+}
+
+// remove the details covered by privacy preferences, and the
+// households that asked to be left out
+// this is done before any families are printed, exported, or saved
+// as an edition; doing it again changes nothing
+func (dir *Directory) ApplyPrivacy() {
+	var kept []*membership.Family
+	for _, family := range dir.Families {
+		// find them all first, since hiding the address can stop
+		// later preferences from matching
+		var prefs []*PrivacyPreference
+		for _, pref := range dir.Privacy {
+			if pref.Matches(family) {
+				prefs = append(prefs, pref)
+			}
+		}
+
+		omit := false
+		for _, pref := range prefs {
+			if pref.Person == "" {
+				// the whole household
+				if pref.Omit {
+					omit = true
+				}
+				if pref.HideAddress {
+					family.Address = nil
+				}
+				if pref.HidePhone {
+					family.Phone = ""
+					for _, person := range family.People {
+						person.Phone = ""
+					}
+				}
+				if pref.HideEmail {
+					family.Email = ""
+					for _, person := range family.People {
+						person.Email = ""
+					}
+				}
+				if pref.HidePhoto {
+					family.Photo = nil
+				}
+				continue
+			}
+
+			// one person
+			key := membership.NameKey(pref.Person)
+			adults := membership.CoupleSize(family)
+			var people []*membership.Person
+			var couple []string
+			for i, person := range family.People {
+				if membership.NameKey(person.Name) == key {
+					if pref.HidePhone {
+						person.Phone = ""
+					}
+					if pref.HideEmail {
+						person.Email = ""
+					}
+					if pref.Omit {
+						continue
+					}
+				}
+				people = append(people, person)
+				if i < adults {
+					couple = append(couple, person.Name)
+				}
+			}
+			if len(people) < len(family.People) {
+				family.People = people
+				family.Couple = strings.Join(couple, " & ")
+				family.HasCouple = len(couple) > 1
+			}
+		}
+		if !omit {
+			kept = append(kept, family)
+		}
+	}
+	dir.Families = kept
+}
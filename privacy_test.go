@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/russross/warddirectory/membership"
+)
+
+// two households to test with, followed by enough others to fill
+// the pages of a directory
+func privacyFamilies() []*membership.Family {
+	families := []*membership.Family{
+		{
+			Surname: "Smith",
+			Couple:  "John & Jane",
+			Phone:   "555-1234",
+			Address: []string{"1 Main St"},
+			People:  []*membership.Person{{Name: "Smith, John"}, {Name: "Smith, Jane"}},
+		},
+		{
+			Surname: "Jones",
+			Couple:  "Mary",
+			Phone:   "555-9876",
+			Address: []string{"2 Main St"},
+			People:  []*membership.Person{{Name: "Jones, Mary"}},
+		},
+	}
+	for i := 0; i < 100; i++ {
+		families = append(families, &membership.Family{
+			Surname: fmt.Sprintf("Family%03d", i),
+			Couple:  "Pat",
+			Address: []string{fmt.Sprintf("%d Elm St", i)},
+			People:  []*membership.Person{{Name: fmt.Sprintf("Family%03d, Pat", i)}},
+		})
+	}
+	return families
+}
+
+func TestApplyPrivacyOmitHousehold(t *testing.T) {
+	dir := &Directory{
+		Families: privacyFamilies(),
+		Privacy:  []*PrivacyPreference{{Surname: "Smith", Address: "1 Main St", Omit: true}},
+	}
+
+	// applying the preferences again changes nothing
+	for i := 0; i < 2; i++ {
+		dir.ApplyPrivacy()
+		for _, family := range dir.Families {
+			if family.Surname == "Smith" {
+				t.Fatalf("pass %d: the Smith household was not left out", i+1)
+			}
+		}
+		if len(dir.Families) != 101 {
+			t.Fatalf("pass %d: expected 101 households, found %d", i+1, len(dir.Families))
+		}
+	}
+}
+
+func TestGenerateEditionPrivacy(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "editions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	old := editionsPath
+	editionsPath = tmp
+	defer func() { editionsPath = old }()
+
+	// the last edition still has the phone number
+	previous := &Directory{Families: privacyFamilies()}
+	data, err := previous.EncodeEdition()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = SaveEdition(data, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	gen, err := NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := gen.Defaults()
+	gen.Prepare(dir)
+	dir.Families = privacyFamilies()
+	dir.Families[1].Phone = "555-0000"
+	dir.Report = new(membership.ParseReport)
+	dir.Privacy = []*PrivacyPreference{{Surname: "Jones", Couple: "Mary", HidePhone: true}}
+	dir.LoadPreviousEdition()
+
+	result, err := dir.Generate(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Changes == nil || len(result.Changes.Changed) != 1 || result.Changes.Changed[0].New != "" {
+		t.Errorf("expected the hidden phone number to be reported as removed, found %+v", result.Changes)
+	}
+
+	latest, err := LatestEdition()
+	if err != nil || latest == nil {
+		t.Fatalf("loading the new edition: %v", err)
+	}
+	for _, family := range latest.Families {
+		if family.Phone == "555-0000" {
+			t.Errorf("the edition kept a hidden phone number")
+		}
+	}
+}
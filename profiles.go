@@ -0,0 +1,68 @@
+//
+// Extraction profiles
+// Code to load the profiles that describe each printed directory
+// format, built in and from the user's profiles file
+//
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/russross/warddirectory/membership"
+)
+
+var profilesPath = homeFile(".warddirectory-profiles.json")
+
+// load the built-in profiles plus any found in the user's profiles file
+// user profiles replace built-in profiles with the same name
+func LoadProfiles() (profiles []*membership.ExtractionProfile, err error) {
+	if err = json.Unmarshal(dataFiles["profiles.json"], &profiles); err != nil {
+		log.Printf("Error parsing built-in extraction profiles: %v", err)
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(profilesPath)
+	if err != nil && os.IsNotExist(err) {
+		return profiles, nil
+	}
+	if err != nil {
+		log.Printf("Error loading extraction profiles file %s: %v", profilesPath, err)
+		return nil, err
+	}
+	var custom []*membership.ExtractionProfile
+	if err = json.Unmarshal(data, &custom); err != nil {
+		log.Printf("Error parsing extraction profiles file %s: %v", profilesPath, err)
+		return nil, err
+	}
+
+	for _, elt := range custom {
+		replaced := false
+		for i, old := range profiles {
+			if old.Name == elt.Name {
+				profiles[i] = elt
+				replaced = true
+			}
+		}
+		if !replaced {
+			profiles = append(profiles, elt)
+		}
+	}
+
+	return profiles, nil
+}
+
+// the names of the available profiles, for the settings form
+func profileNames() (names []string) {
+	profiles, err := LoadProfiles()
+	if err != nil {
+		return nil
+	}
+	for _, elt := range profiles {
+		names = append(names, elt.Name)
+	}
+	return names
+}
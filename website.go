@@ -1,28 +1,73 @@
 package main
 
 import (
-	"bytes"
 	"code.google.com/p/gorilla/schema"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
+
+	"github.com/russross/warddirectory/cleanup"
+	"github.com/russross/warddirectory/membership"
 )
 
 var t *template.Template
-var defaultConfig Directory
 var decoder = schema.NewDecoder()
 
-func saveLocalConfig(config *Directory) (err error) {
-	// where to save?
+// the membership data from the last upload, before overrides are
+// applied, so the households can be edited and the directory generated
+// again with new settings without uploading the files again
+// it is only kept in memory, until it is forgotten or the server stops
+type session struct {
+	sync.Mutex
+	families []*membership.Family
+	report   *membership.ParseReport
+	previous *Edition
+	files    []string
+	loaded   time.Time
+}
+
+// the summary page shown after a directory is generated
+type reportPage struct {
+	Report   *membership.ParseReport
+	Changes  *EditionChanges
+	Marked   int
+	Baseline string
+	FontSize float64
+	PDF      string
+}
+
+// the user's home directory, where the settings and the other files
+// the generator keeps are saved
+// Windows sets USERPROFILE, and other systems set HOME
+func homeDirectory() string {
 	where := os.Getenv("USERPROFILE")
 	if where == "" {
 		where = os.Getenv("HOME")
 	}
+	return where
+}
+
+// the path of a file kept in the user's home directory
+func homeFile(name string) string {
+	return filepath.Join(homeDirectory(), name)
+}
+
+func saveLocalConfig(config *Directory) (err error) {
+	// where to save?
+	where := homeDirectory()
 	if where == "" {
 		panic("Unable to find home directory")
 	}
@@ -40,10 +85,7 @@ func saveLocalConfig(config *Directory) (err error) {
 
 func loadLocalConfig(config *Directory) (err error) {
 	// where to load?
-	where := os.Getenv("USERPROFILE")
-	if where == "" {
-		where = os.Getenv("HOME")
-	}
+	where := homeDirectory()
 	if where == "" {
 		panic("Unable to find home directory")
 	}
@@ -68,10 +110,7 @@ func loadLocalConfig(config *Directory) (err error) {
 
 func deleteLocalConfig() (err error) {
 	// where to delete?
-	where := os.Getenv("USERPROFILE")
-	if where == "" {
-		where = os.Getenv("HOME")
-	}
+	where := homeDirectory()
 	if where == "" {
 		panic("Unable to find home directory")
 	}
@@ -100,9 +139,144 @@ func ifEqual(args ...interface{}) string {
 	return args[len(args)-1].(string)
 }
 
-func index(w http.ResponseWriter, r *http.Request) {
+// read the uploaded membership data (a PDF, spreadsheet, or household file),
+// clean up the addresses, and apply the saved overrides
+// if no files were uploaded, the last upload is used instead
+func (gen *Generator) loadMembership(config *Directory, r *http.Request) error {
+	if r.MultipartForm == nil || len(r.MultipartForm.File["MembershipData"]) == 0 {
+		found, err := gen.loadSession(config)
+		if err == nil && !found {
+			err = fmt.Errorf("getting MembershipData form field: %v", http.ErrMissingFile)
+		}
+		return err
+	}
+	if err := gen.readMembership(config, r); err != nil {
+		return err
+	}
+	return config.ApplySavedOverrides()
+}
+
+// read and combine the uploaded membership files and clean up the addresses
+// the result is kept for later requests
+func (gen *Generator) readMembership(config *Directory, r *http.Request) error {
+	if r.MultipartForm == nil || len(r.MultipartForm.File["MembershipData"]) == 0 {
+		return fmt.Errorf("getting MembershipData form field: %v", http.ErrMissingFile)
+	}
+
+	// load each file, in the order they were selected
+	var files []*MembershipFile
+	var names []string
+	for _, header := range r.MultipartForm.File["MembershipData"] {
+		file, err := header.Open()
+		if err != nil {
+			return fmt.Errorf("opening uploaded file %s: %v", header.Filename, err)
+		}
+		contents, err := ioutil.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("reading uploaded file %s: %v", header.Filename, err)
+		}
+		files = append(files, &MembershipFile{Name: header.Filename, Data: contents})
+		names = append(names, header.Filename)
+	}
+	if err := config.ReadMembership(files); err != nil {
+		return err
+	}
+
+	config.LoadPreviousEdition()
+
+	// keep a copy, since overrides and privacy preferences change the families
+	session := &gen.session
+	session.Lock()
+	session.families = membership.CopyFamilies(config.Families)
+	session.report = config.Report.Copy()
+	session.previous = config.Previous
+	session.files = names
+	session.loaded = time.Now()
+	session.Unlock()
+	return nil
+}
+
+// read the optional baseline file for marking new households
+// it is cleaned up the same way as the membership data so the two
+// can be compared; if none was uploaded, the families are nil
+func loadBaseline(config *Directory, r *http.Request) ([]*membership.Family, string, error) {
+	if r.MultipartForm == nil || len(r.MultipartForm.File["Baseline"]) == 0 {
+		return nil, "", nil
+	}
+	file, header, err := r.FormFile("Baseline")
+	if err != nil {
+		return nil, "", fmt.Errorf("getting Baseline form field: %v", err)
+	}
+	defer file.Close()
+	contents, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, "", fmt.Errorf("reading baseline file: %v", err)
+	}
+	baseline, err := config.ReadBaseline(&MembershipFile{Name: header.Filename, Data: contents})
+	if err != nil {
+		return nil, "", err
+	}
+	return baseline, header.Filename, nil
+}
+
+// the saved settings, ready to generate a directory
+func (gen *Generator) SavedSettings() (*Directory, error) {
+	config := gen.Defaults()
+	if err := loadLocalConfig(config); err != nil {
+		return nil, err
+	}
+	config.Author = "Local clerk"
+	gen.Prepare(config)
+	return config, nil
+}
+
+// fill in the families from the last upload,
+// with the current overrides applied
+// returns false if nothing has been uploaded
+func (gen *Generator) loadSession(config *Directory) (bool, error) {
+	session := &gen.session
+	session.Lock()
+	families, report, previous := session.families, session.report, session.previous
+	session.Unlock()
+	if families == nil {
+		return false, nil
+	}
+
+	// the session copy is never changed
+	config.Families = membership.CopyFamilies(families)
+	config.Report = report.Copy()
+	config.Previous = previous
+	return true, config.ApplySavedOverrides()
+}
+
+// drop the kept membership data
+func (gen *Generator) forgetSession() {
+	session := &gen.session
+	session.Lock()
+	session.families = nil
+	session.report = nil
+	session.previous = nil
+	session.files = nil
+	session.Unlock()
+}
+
+// describe the kept membership data for the settings page,
+// or return "" if there is none
+func (gen *Generator) keptMembership() string {
+	session := &gen.session
+	session.Lock()
+	defer session.Unlock()
+	if session.families == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s (%d households), uploaded at %s",
+		strings.Join(session.files, ", "), len(session.families), session.loaded.Format("3:04 PM"))
+}
+
+func index(w http.ResponseWriter, r *http.Request, gen *Generator) {
 	// load the user's config data (fonts will not be used)
-	config := defaultConfig.Copy()
+	config := gen.Defaults()
 	err := loadLocalConfig(config)
 	if err != nil {
 		log.Printf("index: Failure loading config data from disk: %v", err)
@@ -112,16 +286,38 @@ func index(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// append a blank entry to each regexp list
-	config.PhoneRegexps = append(config.PhoneRegexps, &RegularExpression{})
-	config.AddressRegexps = append(config.AddressRegexps, &RegularExpression{})
-	config.NameRegexps = append(config.NameRegexps, &RegularExpression{})
+	config.PhoneRegexps = append(config.PhoneRegexps, &cleanup.RegularExpression{})
+	config.AddressRegexps = append(config.AddressRegexps, &cleanup.RegularExpression{})
+	config.NameRegexps = append(config.NameRegexps, &cleanup.RegularExpression{})
+	config.Privacy = append(config.Privacy, &PrivacyPreference{})
 
 	t.Execute(w, config)
 }
 
-func submit(w http.ResponseWriter, r *http.Request) {
+// fill in the settings from the submitted form
+// the page settings are named for the embedded Layout, as in
+// Layout.PageWidth, so they decode whether or not the decoder knows
+// about embedded structs
+func decodeSettings(config *Directory, form url.Values) error {
+	// checkboxes are missing if false, so set the checkbox
+	// values to false before decoding
+	config.FullFamily = false
+	config.FamilyPhone = false
+	config.FamilyEmail = false
+	config.FamilyAddress = false
+	config.PersonalPhones = false
+	config.PersonalEmails = false
+	config.MarkNewHouseholds = false
+
+	// the same goes for the privacy checkboxes, so start the list over
+	config.Privacy = nil
+
+	return decoder.Decode(config, form)
+}
+
+func submit(w http.ResponseWriter, r *http.Request, gen *Generator) {
 	// start with the default config
-	config := defaultConfig.Copy()
+	config := gen.Defaults()
 
 	// load saved config into it
 	err := loadLocalConfig(config)
@@ -135,30 +331,13 @@ func submit(w http.ResponseWriter, r *http.Request) {
 	// next fill it in using data from the submitted form
 	r.ParseMultipartForm(1e6)
 	config.Author = "Local clerk"
-
-	// checkboxes are missing if false, so set the checkbox
-	// values to false before decoding
-	config.FullFamily = false
-	config.FamilyPhone = false
-	config.FamilyEmail = false
-	config.FamilyAddress = false
-	config.PersonalPhones = false
-	config.PersonalEmails = false
-
-	if err := decoder.Decode(config, r.Form); err != nil {
+	if err := decodeSettings(config, r.Form); err != nil {
 		log.Printf("Decoding form data: %v", err)
 		http.Error(w, "submit: Decoding form data: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// set the typewriter font
-	if font, present := FontList[config.EmailFont]; present {
-		config.Typewriter = font.Copy()
-	} else {
-		config.Typewriter = FontList[FallbackTypewriter].Copy()
-	}
-	config.CompileRegexps()
-	config.ComputeImplicitFields()
+	gen.Prepare(config)
 
 	action := r.FormValue("SubmitButton")
 
@@ -181,6 +360,50 @@ func submit(w http.ResponseWriter, r *http.Request) {
 		}
 		http.Redirect(w, r, "/", http.StatusFound)
 
+	case action == "Export households":
+		// load the uploaded membership data
+		if err = gen.loadMembership(config, r); err != nil {
+			log.Printf("Export households: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, err := config.ExportHouseholds()
+		if err != nil {
+			log.Printf("Export households: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// return it to the browser
+		w.Header()["Content-Type"] = []string{"application/json"}
+		w.Header()["Content-Disposition"] =
+			[]string{`attachment; filename="households.json"`}
+		w.Write(data)
+
+	case action == "Export photos":
+		// load the uploaded membership data
+		if err = gen.loadMembership(config, r); err != nil {
+			log.Printf("Export photos: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if config.Report.Photos == 0 {
+			http.Error(w, "No household photos were found in the membership data", http.StatusBadRequest)
+			return
+		}
+		data, err := config.ExportPhotos()
+		if err != nil {
+			log.Printf("Export photos: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// return it to the browser
+		w.Header()["Content-Type"] = []string{"application/zip"}
+		w.Header()["Content-Disposition"] =
+			[]string{`attachment; filename="photos.zip"`}
+		w.Write(data)
+
 	case strings.HasPrefix(action, "Export"):
 		// convert it into JSON format
 		data, err := json.MarshalIndent(config, "", "    ")
@@ -213,7 +436,7 @@ func submit(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// unpack it (font will not be used)
-		config := defaultConfig.Copy()
+		config := gen.Defaults()
 		if err = json.Unmarshal(data, config); err != nil {
 			log.Printf("Upload: unable to parse uploaded file: %v", err)
 			http.Error(w, "Unable to parse uploaded file: "+err.Error(), http.StatusBadRequest)
@@ -236,83 +459,443 @@ func submit(w http.ResponseWriter, r *http.Request) {
 		}
 		http.Redirect(w, r, "/", http.StatusFound)
 
-	case action == "Generate":
-		// get the uplaoded PDF data
-		file, _, err := r.FormFile("MembershipData")
-		if err != nil {
-			log.Printf("Generate: getting MembershipData form field: %v", err)
+	case action == "Forget membership data":
+		gen.forgetSession()
+		http.Redirect(w, r, "/", http.StatusFound)
+
+	case action == "Review households":
+		// load the uploaded membership data, which is kept for the editor
+		if err = gen.loadMembership(config, r); err != nil {
+			log.Printf("Review households: %v", err)
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		defer file.Close()
-		contents, err := ioutil.ReadAll(file)
-		if err != nil {
-			log.Printf("Generate: reading uploaded file: %v", err)
-			http.Error(w, "reading uploaded file: "+err.Error(), http.StatusBadRequest)
+		http.Redirect(w, r, "/families", http.StatusFound)
+
+	case action == "Generate" || action == "Regenerate":
+		// load the uploaded membership data
+		if err = gen.loadMembership(config, r); err != nil {
+			log.Printf("Generate: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		src := bytes.NewReader(contents)
+		generate(w, r, config)
+
+	case action == "Shutdown":
+		w.Write([]byte("<h1>Goodbye</h1>\n"))
+		w.(http.Flusher).Flush()
+		log.Fatal("Shutdown at user's request")
 
-		// load and parse the families
-		if err = config.ParseFamilies(src); err != nil {
-			log.Printf("Generate: parsing families: %v", err)
-			http.Error(w, "parsing families: "+err.Error(), http.StatusBadRequest)
+	default:
+		// save
+		http.Redirect(w, r, "/", http.StatusFound)
+	}
+}
+
+// generate the directory from the families that have been loaded,
+// and send back the summary page with the PDF attached
+func generate(w http.ResponseWriter, r *http.Request, config *Directory) {
+	// an uploaded baseline for marking new households
+	var baseline []*membership.Family
+	var baselineName string
+	if config.MarkNewHouseholds {
+		var err error
+		if baseline, baselineName, err = loadBaseline(config, r); err != nil {
+			log.Printf("Generate: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		if err = config.CleanupAddresses(); err != nil {
-			log.Printf("Generate: cleaning up addresses: %v", err)
-			http.Error(w, "cleaning up addresses: "+err.Error(), http.StatusBadRequest)
-			return
+	}
+
+	result, err := config.Generate(baseline, baselineName)
+	if err != nil {
+		log.Printf("Generate: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// send back a summary page with the PDF attached
+	page := &reportPage{
+		Report:   config.Report,
+		Changes:  result.Changes,
+		Marked:   result.Marked,
+		Baseline: result.Baseline,
+		FontSize: config.FontSize,
+		PDF:      base64.StdEncoding.EncodeToString(result.PDF),
+	}
+	w.Header()["Content-Type"] = []string{"text/html; charset=utf-8"}
+	if err = t.ExecuteTemplate(w, "report.html", page); err != nil {
+		log.Printf("Generate: rendering the report: %v", err)
+	}
+}
+
+// the page for managing household overrides
+type overridesPageData struct {
+	Rows  []*overrideRow
+	Error string
+}
+
+type overrideRow struct {
+	Index    int
+	Number   int
+	Override *Override
+}
+
+// split a text area into trimmed, non-blank lines
+func formLines(s string) (lines []string) {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
 		}
-		if err = config.PrepareFamilies(); err != nil {
-			log.Printf("Generate: preparing families: %v", err)
-			http.Error(w, "preparing families: "+err.Error(), http.StatusBadRequest)
-			return
+	}
+	return lines
+}
+
+// people are entered one per line as "Name; phone; email"
+func formPeople(s string) (people []*membership.Person) {
+	for _, line := range formLines(s) {
+		fields := strings.Split(line, ";")
+		for len(fields) < 3 {
+			fields = append(fields, "")
 		}
+		people = append(people, &membership.Person{
+			Name:  strings.TrimSpace(fields[0]),
+			Phone: strings.TrimSpace(fields[1]),
+			Email: strings.TrimSpace(fields[2]),
+		})
+	}
+	return people
+}
 
-		// format families
-		config.FormatFamilies()
+func overridesPage(w http.ResponseWriter, r *http.Request, gen *Generator) {
+	// the overrides are loaded, changed, and saved as one step
+	gen.overridesLock.Lock()
+	defer gen.overridesLock.Unlock()
 
-		// find the font size
-		var rounds int
-		if rounds, err = config.FindFontSize(); err != nil {
-			log.Printf("Generate: finding font site: %v", err)
-			http.Error(w, "finding font size: "+err.Error(), http.StatusBadRequest)
+	overrides, err := LoadOverrides()
+	if err != nil {
+		log.Printf("overrides: loading: %v", err)
+		http.Error(w, "Failure loading overrides: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	page := new(overridesPageData)
+	for i, override := range overrides {
+		page.Rows = append(page.Rows, &overrideRow{Index: i, Number: i + 1, Override: override})
+	}
+
+	if r.Method == "POST" {
+		r.ParseForm()
+		switch r.FormValue("SubmitButton") {
+		case "Add override":
+			override := &Override{
+				Action:      r.FormValue("Action"),
+				Note:        strings.TrimSpace(r.FormValue("Note")),
+				Surname:     strings.TrimSpace(r.FormValue("Surname")),
+				Couple:      strings.TrimSpace(r.FormValue("Couple")),
+				Address:     formLines(r.FormValue("Address")),
+				Phone:       strings.TrimSpace(r.FormValue("Phone")),
+				Email:       strings.TrimSpace(r.FormValue("Email")),
+				NewAddress:  formLines(r.FormValue("NewAddress")),
+				Person:      strings.TrimSpace(r.FormValue("Person")),
+				PersonName:  strings.TrimSpace(r.FormValue("PersonName")),
+				PersonPhone: strings.TrimSpace(r.FormValue("PersonPhone")),
+				PersonEmail: strings.TrimSpace(r.FormValue("PersonEmail")),
+			}
+
+			// a new household lists its adults first
+			if override.Action == OverrideAdd {
+				adults := formPeople(r.FormValue("Adults"))
+				var names []string
+				for _, person := range adults {
+					names = append(names, person.Name)
+				}
+				override.Couple = strings.Join(names, " & ")
+				override.People = append(adults, formPeople(r.FormValue("Children"))...)
+			}
+
+			if err = override.Validate(); err != nil {
+				page.Error = err.Error()
+				break
+			}
+			overrides = append(overrides, override)
+
+		case "Delete":
+			n, err := strconv.Atoi(r.FormValue("Index"))
+			if err != nil || n < 0 || n >= len(overrides) {
+				http.Error(w, "No such override", http.StatusBadRequest)
+				return
+			}
+			overrides = append(overrides[:n], overrides[n+1:]...)
+		}
+
+		if page.Error == "" {
+			if err = SaveOverrides(overrides); err != nil {
+				log.Printf("overrides: saving: %v", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			http.Redirect(w, r, "/overrides", http.StatusFound)
 			return
 		}
-		log.Printf("Found font size %.3f in %d rounds", config.FontSize, rounds)
+	}
 
-		// render the header and footer
-		config.RenderHeader()
-		config.RenderFooter()
+	w.Header()["Content-Type"] = []string{"text/html; charset=utf-8"}
+	if err = t.ExecuteTemplate(w, "overrides.html", page); err != nil {
+		log.Printf("overrides: rendering: %v", err)
+	}
+}
 
-		// render the family listings
-		config.SplitIntoLines()
-		config.RenderColumns()
+// the page for reviewing and editing the uploaded households
+type familiesPageData struct {
+	Rows   []*familyRow
+	Count  int
+	Errors []string
+}
+
+type familyRow struct {
+	Index    int
+	Key      string
+	Family   *membership.Family
+	Adults   string
+	Children string
+	Address  string
+}
+
+// people are shown one per line as "Name; phone; email"
+func peopleLines(people []*membership.Person) string {
+	var lines []string
+	for _, person := range people {
+		fields := []string{person.Name, person.Phone, person.Email}
+		for len(fields) > 1 && fields[len(fields)-1] == "" {
+			fields = fields[:len(fields)-1]
+		}
+		lines = append(lines, strings.Join(fields, "; "))
+	}
+	return strings.Join(lines, "\n")
+}
 
-		// generate the PDF file
-		var pdf []byte
-		if pdf, err = config.MakePDF(); err != nil {
-			log.Printf("Generate: making the PDF: %v", err)
-			http.Error(w, "making the PDF: "+err.Error(), http.StatusBadRequest)
+// identifies a row, so edits are not applied to the wrong family
+// if the list changed since the page was loaded
+func familyRowKey(family *membership.Family) string {
+	return strings.Join(membership.FamilyKeys(family), "|")
+}
+
+// the family as edited in row i, or nil if it was not changed
+func editedFamily(r *http.Request, i int, family *membership.Family) *membership.Family {
+	field := func(name string) string {
+		return r.FormValue(fmt.Sprintf("%s.%d", name, i))
+	}
+	adults := formPeople(field("Adults"))
+	children := formPeople(field("Children"))
+	edited := &membership.Family{
+		Surname: strings.TrimSpace(field("Surname")),
+		Couple:  family.Couple,
+		Address: formLines(field("Address")),
+		Phone:   strings.TrimSpace(field("Phone")),
+		Email:   strings.TrimSpace(field("Email")),
+		People:  append(adults, children...),
+	}
+
+	// keep the couple as it was unless the parents changed
+	n := membership.CoupleSize(family)
+	adultsChanged := peopleLines(adults) != peopleLines(family.People[:n])
+	if adultsChanged {
+		var names []string
+		for _, person := range adults {
+			names = append(names, person.Name)
+		}
+		edited.Couple = strings.Join(names, " & ")
+	}
+
+	if !adultsChanged &&
+		edited.Surname == family.Surname &&
+		strings.Join(edited.Address, "\n") == strings.Join(family.Address, "\n") &&
+		edited.Phone == family.Phone &&
+		edited.Email == family.Email &&
+		peopleLines(children) == peopleLines(family.People[n:]) {
+		return nil
+	}
+	return edited
+}
+
+func familiesPage(w http.ResponseWriter, r *http.Request, gen *Generator) {
+	config := new(Directory)
+	found, err := gen.loadSession(config)
+	if err != nil {
+		log.Printf("families: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "No membership data has been uploaded for review; "+
+			"select a membership file on the main page and click “Review households”", http.StatusBadRequest)
+		return
+	}
+	page := &familiesPageData{Count: len(config.Families)}
+
+	if r.Method == "POST" {
+		r.ParseMultipartForm(1e6)
+		action := r.FormValue("SubmitButton")
+
+		// turn the changes into overrides
+		var changes []*Override
+		stale := r.FormValue("Count") != strconv.Itoa(len(config.Families))
+		for i, family := range config.Families {
+			if stale || r.FormValue(fmt.Sprintf("Key.%d", i)) != familyRowKey(family) {
+				stale = true
+				break
+			}
+			override := &Override{
+				Surname: family.Surname,
+				Couple:  family.Couple,
+				Address: family.Address,
+			}
+			if r.FormValue(fmt.Sprintf("Remove.%d", i)) != "" {
+				override.Action = OverrideHide
+			} else if edited := editedFamily(r, i, family); edited != nil {
+				override.Action = OverrideReplace
+				override.Family = edited
+			} else {
+				continue
+			}
+			if err = override.Validate(); err != nil {
+				page.Errors = append(page.Errors, fmt.Sprintf("%s: %v; this change was not saved", familyLabel(family), err))
+				continue
+			}
+			changes = append(changes, override)
+		}
+		if stale {
+			changes = nil
+			page.Errors = []string{"The households changed since this page was loaded, so your changes were not saved"}
+		}
+
+		if len(changes) > 0 {
+			gen.overridesLock.Lock()
+			overrides, err := LoadOverrides()
+			if err == nil {
+				err = SaveOverrides(append(overrides, changes...))
+			}
+			gen.overridesLock.Unlock()
+			if err != nil {
+				log.Printf("families: saving overrides: %v", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if len(page.Errors) == 0 {
+			if action != "Generate" {
+				http.Redirect(w, r, "/families", http.StatusFound)
+				return
+			}
+
+			// generate with the saved settings and the edited households
+			config, err = gen.SavedSettings()
+			if err == nil {
+				_, err = gen.loadSession(config)
+			}
+			if err != nil {
+				log.Printf("families: %v", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			generate(w, r, config)
 			return
 		}
 
-		// set the headers and send the PDF back to the browser
-		w.Header()["Content-Type"] = []string{"application/pdf"}
-		w.Header()["Content-Disposition"] =
-			[]string{`attachment; filename="directory.pdf"`}
-		w.Write(pdf)
+		// show the list again with the changes that were saved
+		config = new(Directory)
+		if _, err = gen.loadSession(config); err != nil {
+			log.Printf("families: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		page.Count = len(config.Families)
+	}
 
-	case action == "Shutdown":
-		w.Write([]byte("<h1>Goodbye</h1>\n"))
-		w.(http.Flusher).Flush()
-		log.Fatal("Shutdown at user's request")
+	for i, family := range config.Families {
+		n := membership.CoupleSize(family)
+		page.Rows = append(page.Rows, &familyRow{
+			Index:    i,
+			Key:      familyRowKey(family),
+			Family:   family,
+			Adults:   peopleLines(family.People[:n]),
+			Children: peopleLines(family.People[n:]),
+			Address:  strings.Join(family.Address, "\n"),
+		})
+	}
 
-	default:
-		// save
-		http.Redirect(w, r, "/", http.StatusFound)
+	w.Header()["Content-Type"] = []string{"text/html; charset=utf-8"}
+	if err = t.ExecuteTemplate(w, "families.html", page); err != nil {
+		log.Printf("families: rendering: %v", err)
+	}
+}
+
+// the pages laid out with the saved settings, shown on the settings page
+// Rounds counts rounds of Width trial layouts done at the same time
+type previewData struct {
+	FontSize float64
+	Rounds   int
+	Width    int
+	Pages    []string
+	Error    string
+}
+
+// run the directory through the layout steps and draw the pages
+func layoutPreview(config *Directory) (*previewData, error) {
+	// mark new households against the edition saved before the data
+	// was uploaded, which was saved with the privacy preferences applied
+	config.ApplyPrivacy()
+	if config.MarkNewHouseholds && config.Previous != nil {
+		config.MarkNew(config.Previous.Families)
+	}
+	if err := config.PrepareFamilies(); err != nil {
+		return nil, fmt.Errorf("preparing families: %v", err)
 	}
+	config.FormatFamilies()
+	rounds, err := config.FindFontSize()
+	if err != nil {
+		return nil, err
+	}
+	config.SplitIntoLines()
+	return &previewData{
+		FontSize: config.FontSize,
+		Rounds:   rounds,
+		Width:    runtime.GOMAXPROCS(0),
+		Pages:    config.RenderSVG(),
+	}, nil
+}
+
+func preview(w http.ResponseWriter, r *http.Request, gen *Generator) {
+	config, err := gen.SavedSettings()
+	if err != nil {
+		log.Printf("preview: Failure loading config data from disk: %v", err)
+		http.Error(w, "Failure loading config data from disk: "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+
+	// problems with the settings or data are shown in place of the preview
+	result := new(previewData)
+	found, err := gen.loadSession(config)
+	if err == nil && !found {
+		result.Error = "Select a membership data file and click “Generate” to see a preview here"
+	} else if err == nil {
+		result, err = layoutPreview(config)
+	}
+	if err != nil {
+		log.Printf("preview: %v", err)
+		result = &previewData{Error: err.Error()}
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("preview: json.Marshal: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header()["Content-Type"] = []string{"application/json"}
+	w.Write(data)
 }
 
 func jq(w http.ResponseWriter, r *http.Request) {
@@ -330,34 +913,42 @@ func ico(w http.ResponseWriter, r *http.Request) {
 	w.Write(dataFiles["favicon.ico"])
 }
 
-func main() {
-	// do some setup
-	var err error
-
-	// now load the templates
+// run the web interface, listening on the given address
+func serve(addr string, gen *Generator) {
+	// load the templates
 	t = new(template.Template)
 	t.Funcs(template.FuncMap{
-		"ifEqual": ifEqual,
+		"ifEqual":        ifEqual,
+		"profileNames":   profileNames,
+		"keptMembership": gen.keptMembership,
 	})
 	template.Must(t.Parse(string(dataFiles["page.html"])))
-
-	// load the default config file
-	if err = json.Unmarshal(dataFiles["default.json"], &defaultConfig); err != nil {
-		log.Fatal("Unable to parse default config file: ", err)
-	}
-	defaultConfig.ComputeImplicitFields()
-	defaultConfig.Roman = FontList["times-roman"]
-	defaultConfig.Bold = FontList["times-bold"]
-
-	http.HandleFunc("/", index)
-	http.HandleFunc("/submit", submit)
+	template.Must(t.New("report.html").Parse(string(dataFiles["report.html"])))
+	template.Must(t.New("overrides.html").Parse(string(dataFiles["overrides.html"])))
+	template.Must(t.New("families.html").Parse(string(dataFiles["families.html"])))
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { index(w, r, gen) })
+	http.HandleFunc("/submit", func(w http.ResponseWriter, r *http.Request) { submit(w, r, gen) })
+	http.HandleFunc("/overrides", func(w http.ResponseWriter, r *http.Request) { overridesPage(w, r, gen) })
+	http.HandleFunc("/families", func(w http.ResponseWriter, r *http.Request) { familiesPage(w, r, gen) })
+	http.HandleFunc("/preview", func(w http.ResponseWriter, r *http.Request) { preview(w, r, gen) })
 	http.HandleFunc("/jquery.min.js", jq)
 	http.HandleFunc("/jquery-ui.min.js", jqui)
 	http.HandleFunc("/favicon.ico", ico)
 
+	// the address to give the browser
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		log.Fatalf("Bad address %q: %v", addr, err)
+	}
+	switch host {
+	case "", "127.0.0.1", "0.0.0.0", "::", "::1":
+		host = "localhost"
+	}
+
 	log.Print("Ward Directory Generator")
-	log.Print("Open a browser and go to http://localhost:1830/")
+	log.Printf("Open a browser and go to http://%s/", net.JoinHostPort(host, port))
 	log.Print("See http://russross.github.com/warddirectory/")
 	log.Print("    for more information")
-	log.Fatal(http.ListenAndServe("127.0.0.1:1830", nil))
+	log.Fatal(http.ListenAndServe(addr, nil))
 }
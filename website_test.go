@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/russross/warddirectory/layout"
+)
+
+func TestDecodeSettings(t *testing.T) {
+	gen, err := NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := gen.Defaults()
+	config.FamilyPhone = true
+
+	form := url.Values{
+		"Layout.Title":          {"Third Ward"},
+		"Layout.PageWidth":      {"612"},
+		"Layout.Pages":          {"3"},
+		"Layout.ColumnsPerPage": {"4"},
+		"FamilyEmail":           {"true"},
+		"Privacy.0.Surname":     {"Smith"},
+		"Privacy.0.Omit":        {"true"},
+	}
+	if err := decodeSettings(config, form); err != nil {
+		t.Fatal(err)
+	}
+	if config.Title != "Third Ward" || config.PageWidth != 612 || config.Pages != 3 || config.ColumnsPerPage != 4 {
+		t.Errorf("the page settings were not decoded: %q %v %d %d", config.Title, config.PageWidth, config.Pages, config.ColumnsPerPage)
+	}
+	if config.FamilyPhone || !config.FamilyEmail {
+		t.Errorf("the checkboxes were not decoded")
+	}
+	if len(config.Privacy) != 1 || config.Privacy[0].Surname != "Smith" || !config.Privacy[0].Omit {
+		t.Errorf("the privacy preferences were not decoded")
+	}
+}
+
+// the settings page must use the Layout. prefix for the page settings
+func TestPageLayoutNames(t *testing.T) {
+	fields := make(map[string]bool)
+	kind := reflect.TypeOf(layout.Layout{})
+	for i := 0; i < kind.NumField(); i++ {
+		fields[kind.Field(i).Name] = true
+	}
+
+	names := regexp.MustCompile(`name="([A-Za-z]+)"`)
+	for _, match := range names.FindAllStringSubmatch(string(dataFiles["page.html"]), -1) {
+		if fields[match[1]] {
+			t.Errorf("page.html: form field %s should be named Layout.%s", match[1], match[1])
+		}
+	}
+}